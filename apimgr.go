@@ -1,15 +1,12 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
 	"fmt"
 	"github.com/360EntSecGroup-Skylar/excelize"
 	amf_crypto "github.com/mft-labs/amf_crypto"
 	"gopkg.in/ini.v1"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -27,12 +24,22 @@ type apiMgr struct {
 	infile     string
 	bkpfile    string
 	bkpdir     string
+	statedir   string
+	journaldir string
+	run        *runJournal
 	bkpfileptr *excelize.File
 	config     *ini.File
 	errorsList []string
+	readOnly   bool
+	strategy   string
+	backups    map[string][]b2bapi.CodeList
+	client     *b2bapi.Client
+	columns    map[string]string
+	format     string
 }
 
 type codelistItem struct {
+	row          int
 	active       string
 	senderCode   string
 	receiverCode string
@@ -40,55 +47,6 @@ type codelistItem struct {
 	text         [10]string
 }
 
-/*
-[
-  {
-    "_id": "Zydus_SAP_Cust|||1",
-    "codeListName": "Zydus_SAP_Cust",
-    "versionNumber": 1,
-    "createDate": "2019-05-16T17:08:52.000+0000",
-    "userName": "apiuser",
-    "listStatus": 1,
-    "codes": [
-      {
-        "senderCode": "test1",
-        "receiverCode": "testre",
-        "description": "no test"
-      }
-    ]
-  }
-]
-*/
-
-type Code struct {
-	senderCode   string
-	receiverCode string
-	description  string
-	text1        string `json:"item,omitempty"`
-	text2        string `json:"item,omitempty"`
-	text3        string `json:"item,omitempty"`
-	text4        string `json:"item,omitempty"`
-	text5        string `json:"item,omitempty"`
-	text6        string `json:"item,omitempty"`
-	text7        string `json:"item,omitempty"`
-	text8        string `json:"item,omitempty"`
-	text9        string `json:"item,omitempty"`
-}
-
-type CodeListItem struct {
-	_id           string    `json:"item,omitempty"`
-	codeListName  string    `json:"item,omitempty"`
-	versionNumber float64   `json:"item,omitempty"`
-	createDate    time.Time `json:"item,omitempty"`
-	userName      string    `json:"item,omitempty"`
-	listStatus    float64   `json:"item,omitempty"`
-	codes         []Code    `json:"list"`
-}
-
-type CodeListItemResponse struct {
-	Collection []CodeListItem
-}
-
 func formattedCurTimeStamp(format string) string {
 	t := time.Now()
 	return t.Format(format)
@@ -116,24 +74,44 @@ func (mgr *apiMgr) init() error {
 		mgr.addError("apiurl")
 	}
 
+	if mgr.strategy == "" {
+		mgr.strategy = sec.Key("strategy").MustString(strategyReplace)
+	}
+	if mgr.strategy != strategyReplace && mgr.strategy != strategyNewVersion && mgr.strategy != strategyMerge {
+		mgr.addError("ERROR: invalid strategy \"" + mgr.strategy + "\" (replace, new-version or merge)")
+	}
+
+	var columnErrors []string
+	mgr.columns, columnErrors = loadColumnAliases(mgr.config)
+	mgr.errorsList = append(mgr.errorsList, columnErrors...)
+
 	mgr.bkpdir = sec.Key("backupdir").String()
 	if mgr.bkpdir == "" {
 		mgr.bkpdir = "codelist-backup"
 	}
+	mgr.statedir = sec.Key("statedir").MustString("codelist-state")
+	mgr.journaldir = sec.Key("journaldir").MustString("codelist-journal")
+
+	clientOptions, optionErrors := loadClientOptions(mgr.config)
+	mgr.errorsList = append(mgr.errorsList, optionErrors...)
 
 	if len(mgr.errorsList) > 0 {
 		return fmt.Errorf("Missing keys")
 	}
+	mgr.client = b2bapi.NewClient(mgr.apiurl, mgr.username, mgr.password, clientOptions)
 
 	err = mgr.validateApiUrl()
 	if err != nil {
-		mgr.addError("ERROR: invalid apiurl or unable to reach the end-point")
+		mgr.addError("ERROR: invalid apiurl or unable to reach the end-point " + err.Error())
 		mgr.showErrors("")
 		os.Exit(20001)
 	}
 	mgr.codelist = ""
-	mgr.bkpfile = "bkp_codelist_" + formattedCurTimeStamp(timestamp_format) + ".xlsx"
+	mgr.bkpfile = uniqueBackupFile(mgr.bkpdir, "bkp_codelist_"+formattedCurTimeStamp(timestamp_format))
 	mgr.bkpfileptr = excelize.NewFile()
+	if mgr.readOnly {
+		return nil
+	}
 	if _, err := os.Stat(mgr.bkpdir); os.IsNotExist(err) {
 		fmt.Printf("Creating backup directory: %s\n", mgr.bkpdir)
 		os.MkdirAll(mgr.bkpdir, os.ModePerm)
@@ -143,6 +121,16 @@ func (mgr *apiMgr) init() error {
 
 }
 
+// uniqueBackupFile returns the name of a backup file not found in dir, a
+// counter is added to base when base.xlsx exists.
+func uniqueBackupFile(dir, base string) string {
+	name := base + ".xlsx"
+	for n := 2; fileExists(dir + "/" + name); n++ {
+		name = fmt.Sprintf("%s_%d.xlsx", base, n)
+	}
+	return name
+}
+
 func (mgr *apiMgr) showErrors(title string) {
 	fmt.Println("AMF CodeList Manager")
 	fmt.Println("======================================================================")
@@ -156,165 +144,187 @@ func (mgr *apiMgr) showErrors(title string) {
 }
 
 func (mgr *apiMgr) validateApiUrl() error {
-	// /B2BAPIs/svc/codelists/?locale=en_US&_range=0-999&_accept=application%2Fjson&_contentType=application%2Fjson&_method=HEAD
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	queryParams := "?locale=en_US&_range=0-999&_accept=application%2Fjson&_contentType=application%2Fjson&_method=HEAD"
-	req, err := http.NewRequest("HEAD", mgr.apiurl+"/B2BAPIs/svc/codelists/"+queryParams, nil)
-	req.SetBasicAuth(mgr.username, mgr.password)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		//fmt.Printf("%s (1)",err)
-		return err
-	}
-	defer resp.Body.Close()
-	_, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		//fmt.Printf("%s (2)",err);
-		return fmt.Errorf("ERROR: invalid api url")
-	}
-	if 200 != resp.StatusCode {
-		//fmt.Printf("ERROR: Response Code -> %d",resp.StatusCode)
-		return fmt.Errorf("ERROR: invalid api url")
-	}
-	return nil
+	return mgr.client.Ping()
 }
 
 func (mgr *apiMgr) runUpdate() error {
 	//fmt.Println("Running bulk update using "+ mgr.infile +" for code list "+mgr.codelist+" using account "+mgr.username)
 	fmt.Println("Sterling B2B Integrator \"Code Lists\" are being updated using \"" + mgr.username + "\" account and \"" + mgr.infile + "\"")
-	f, err := excelize.OpenFile(mgr.infile)
+	fmt.Println("Update strategy: " + mgr.strategy)
+	lists, err := readInput(mgr.infile, mgr.format)
 	if err != nil {
-		return fmt.Errorf("ERROR - Invalid input file [%s]", mgr.infile)
+		mgr.addError("ERROR - Invalid input file [" + mgr.infile + "] " + err.Error())
+		return err
+	}
+	names := make([]string, 0, len(lists))
+	for _, list := range lists {
+		names = append(names, list.name)
+	}
+	if !mgr.checkSchemas(names) {
+		return fmt.Errorf("Invalid schema, no Code List updated")
+	}
+	if !mgr.checkLayouts(lists) {
+		return fmt.Errorf("Invalid header row, no Code List updated")
 	}
 
-	backupDone := false
-	for _, name := range f.GetSheetMap() {
-		mgr.codelist = name
-		if mgr.codelist != "Instructions" {
-			mgr.backupCodelist()
-			backupDone = true
+	resumed := mgr.run != nil
+	if resumed {
+		fmt.Println("Resuming run " + mgr.run.id + ", journal \"" + mgr.run.path + "\"")
+		mgr.journal(journalEntry{Step: stepResume})
+	} else {
+		runID := strings.TrimSuffix(strings.TrimPrefix(mgr.bkpfile, "bkp_codelist_"), ".xlsx")
+		mgr.run, err = newJournal(mgr.journaldir, mgr.bkpdir, runID)
+		if err != nil {
+			mgr.addError("ERROR: unable to create the run journal " + err.Error())
+			return err
 		}
+		mgr.bkpfile = "bkp_codelist_" + mgr.run.id + ".xlsx"
+		mgr.journal(journalEntry{Step: stepStart, Input: mgr.infile, Format: mgr.format, Strategy: mgr.strategy, Hash: inputHash(lists), Backup: mgr.bkpdir + "/" + mgr.bkpfile})
+		fmt.Println("Run " + runID + ", journal \"" + mgr.run.path + "\"")
 	}
-	if !backupDone {
-		mgr.addError("ERROR: invalid input document or CodeList(s) not found")
-		mgr.showErrors("")
-		os.Exit(20002)
-	}
-	mgr.bkpfileptr.DeleteSheet("Sheet1")
-	ok := mgr.bkpfileptr.SaveAs(mgr.bkpdir + "/" + mgr.bkpfile)
 
 	codelistFailedArr := make([]string, 0)
-	if ok == nil {
-		fmt.Println("A backup file \"" + mgr.bkpfile + "\" has been created.")
-		//fmt.Println("Backup file created for codelist successfully, continuing for bulk update of codelist")
-		//fmt.Println("Going to clean the codelists")
-
-		//Removed delete of codelists as per discussion with Raja on 29th May, 2019
-		f2, err := excelize.OpenFile(mgr.bkpdir + "/" + mgr.bkpfile)
+	if resumed && mgr.run.done(stepBackupFile, "") {
+		mgr.backups, err = mgr.readBackupVersions(mgr.run)
 		if err != nil {
-			fmt.Println("Error occurred while trying to clean up Code Lists", err)
-			os.Exit(3)
+			return fmt.Errorf("ERROR - Invalid backup file [%s] %s", mgr.run.start().Backup, err)
 		}
-		//warning:=false;
-		for _, name := range f2.GetSheetMap() {
-			if name != "Sheet1" {
-				err := mgr.deleteCodelist(name)
-				if err != nil {
-					fmt.Println("Unable to delete the Code List: \"" + name + "\"")
-					fmt.Println("It is recommended to remove all versions of this Code List: \"" + name + "\" manually and run the script again.")
-					fmt.Println("Continuing with remaining Code Lists")
-					//os.Exit(2)
-					//warning=true;
-					codelistFailedArr = append(codelistFailedArr, name)
-				}
+		fmt.Println("Using the backup file \"" + mgr.bkpfile + "\" of the run.")
+		for _, list := range lists {
+			if !mgr.run.done(stepBackup, list.name) {
+				fmt.Println("The Code List: \"" + list.name + "\" was not backed up by the run, it is not updated")
+				codelistFailedArr = append(codelistFailedArr, list.name)
 			}
 		}
-
 	} else {
-		return fmt.Errorf("Failed to create backup file [%s]", mgr.bkpfile)
+		backupDone := false
+		for _, list := range lists {
+			mgr.codelist = list.name
+			backupDone = true
+			err := mgr.backupCodelist()
+			if err != nil {
+				fmt.Println("Unable to back up the Code List: \"" + mgr.codelist + "\", it is not updated " + err.Error())
+				mgr.journal(journalEntry{Step: stepFailed, List: mgr.codelist, Detail: "backup failed: " + err.Error()})
+				codelistFailedArr = append(codelistFailedArr, mgr.codelist)
+				continue
+			}
+			entry := journalEntry{Step: stepBackup, List: mgr.codelist, Versions: versionIDs(mgr.backups[mgr.codelist])}
+			if codelist, err := store.ResolveVersion(mgr.codelist, mgr.backups[mgr.codelist]); err == nil {
+				entry.ID = codelist.ID
+				entry.Hash = codesHash(codelist.Codes)
+			}
+			mgr.journal(entry)
+		}
+		if !backupDone {
+			mgr.addError("ERROR: invalid input document or CodeList(s) not found")
+			mgr.showErrors("")
+			os.Exit(20002)
+		}
+		mgr.bkpfileptr.DeleteSheet("Sheet1")
+		ok := mgr.bkpfileptr.SaveAs(mgr.bkpdir + "/" + mgr.bkpfile)
+		if ok != nil {
+			return fmt.Errorf("Failed to create backup file [%s]", mgr.bkpfile)
+		}
+		mgr.journal(journalEntry{Step: stepBackupFile, Backup: mgr.bkpdir + "/" + mgr.bkpfile})
+		fmt.Println("A backup file \"" + mgr.bkpfile + "\" has been created.")
+	}
+	//fmt.Println("Backup file created for codelist successfully, continuing for bulk update of codelist")
+	//fmt.Println("Going to clean the codelists")
+
+	//Removed delete of codelists as per discussion with Raja on 29th May, 2019
+	f2, err := excelize.OpenFile(mgr.bkpdir + "/" + mgr.bkpfile)
+	if err != nil {
+		fmt.Println("Error occurred while trying to clean up Code Lists", err)
+		os.Exit(3)
+	}
+	//warning:=false;
+	sheets, sheetErrors := readBackupSheets(f2)
+	if len(sheetErrors) > 0 {
+		for _, errormsg := range sheetErrors {
+			mgr.addError(errormsg)
+		}
+		return fmt.Errorf("ERROR - Invalid backup file [%s] with %d invalid sheet(s), no Code List has been deleted", mgr.bkpfile, len(sheetErrors))
+	}
+	for _, sheet := range sheets {
+		if mgr.strategy == strategyReplace {
+			name, listName := sheet.id, sheet.name
+			if mgr.run.deleted(name) || mgr.run.done(stepApplied, listName) {
+				continue
+			}
+			err := mgr.client.Delete(name)
+			if resumed && b2bapi.IsNotFound(err) {
+				// deleted before the run stopped
+				err = nil
+			}
+			if err != nil {
+				fmt.Println("Unable to delete the Code List: \"" + name + "\"")
+				fmt.Println("It is recommended to remove all versions of this Code List: \"" + name + "\" manually and run the script again.")
+				fmt.Println("Continuing with remaining Code Lists")
+				//os.Exit(2)
+				//warning=true;
+				mgr.journal(journalEntry{Step: stepFailed, List: listName, ID: name, Detail: "delete failed: " + err.Error()})
+				codelistFailedArr = append(codelistFailedArr, name)
+				continue
+			}
+			mgr.journal(journalEntry{Step: stepDeleted, List: listName, ID: name})
+		}
 	}
-	for _, name := range f.GetSheetMap() {
+
+	verified := 0
+	for _, list := range lists {
 		codelistErrors := make([]string, 0)
-		mgr.codelist = name
+		mgr.codelist = list.name
 		if mgr.codelistFailed(codelistFailedArr) {
 			continue
 		}
+		if mgr.codelist == "Instructions" {
+			verified++
+			continue
+		}
+		if resumed && mgr.run.done(stepVerified, mgr.codelist) {
+			fmt.Println(mgr.codelist, " already updated and verified by the run.")
+			verified++
+			continue
+		}
+		if applied, ok := mgr.run.last(stepApplied, mgr.codelist); resumed && ok {
+			if mgr.verifyCodelist(applied.Hash) {
+				fmt.Println(mgr.codelist, " already updated by the run, verified.")
+				verified++
+				continue
+			}
+			fmt.Println(mgr.codelist, " is updated again.")
+		}
 		//mgr.backupCodelist()
-		if mgr.codelist != "Instructions" {
-			//fmt.Println("Updating codelist ->  "+mgr.codelist)
-			rows := f.GetRows(mgr.codelist)
-			var codelist = make([]map[string]string, 0)
-			rownum := 0
-			for _, row := range rows {
-				rownum = rownum + 1
-				clitem := &codelistItem{}
-				clitem.active = row[0]
-				clitem.senderCode = row[1]
-				clitem.receiverCode = row[2]
-				clitem.description = row[3]
-				for i := 1; i <= 9; i++ {
-					if len(row) >= i+3 {
-						clitem.text[i-1] = row[i+3]
-					} else {
-						clitem.text[i-1] = ""
-					}
-
-				}
-				//clist = append(clist,clitem)
-				if (clitem.active == "Yes") && (clitem.senderCode == "" || clitem.receiverCode == "") {
-					codelistErrors = append(codelistErrors, "ERROR: invalid data (sendercode or receivercode missing) ignoring at row "+strconv.Itoa(rownum))
-					continue
-				}
-				msg := map[string]string{
-					"senderCode":   clitem.senderCode,
-					"receiverCode": clitem.receiverCode,
-					"description":  clitem.description,
-					"text1":        clitem.text[0],
-					"text2":        clitem.text[1],
-					"text3":        clitem.text[2],
-					"text4":        clitem.text[3],
-					"text5":        clitem.text[4],
-					"text6":        clitem.text[5],
-					"text7":        clitem.text[6],
-					"text8":        clitem.text[7],
-					"text9":        clitem.text[8],
-				}
-				if clitem.active == "Yes" {
-					codelist = append(codelist, msg)
-					/*val, err := json.Marshal(msg)
-					        if err == nil {
-						        //fmt.Println(string(val))
-					        } else {
-					        	fmt.Println(err)
-					        }*/
-				}
+		//fmt.Println("Updating codelist ->  "+mgr.codelist)
+		items, itemErrors := readCodelistRows(mgr.codelist, list.rows, mgr.listColumns(mgr.codelist), list.workbook)
+		codelistErrors = append(codelistErrors, itemErrors...)
+		if mgr.strategy != strategyMerge {
+			var loadErrors []string
+			items, loadErrors = wantedItems(liveItems(mgr.backups[mgr.codelist]), items)
+			codelistErrors = append(codelistErrors, loadErrors...)
+		}
+		switch mgr.strategy {
+		case strategyNewVersion:
+			err = mgr.createVersion(items)
+		case strategyMerge:
+			var mergeErrors []string
+			items, mergeErrors, err = mgr.mergeLive(items)
+			codelistErrors = append(codelistErrors, mergeErrors...)
+			if err != nil {
+				codelistErrors = append(codelistErrors, "ERROR: unable to read the Code List, not merged "+err.Error())
+			} else {
+				err = mgr.updateCodelist(items)
 			}
-			val2, err := json.Marshal(codelist)
-			if err == nil {
-				requestInfo := "{" + "\"codes\":" + string(val2) + ",\"listStatus\":1" + "}"
-				//fmt.Println(requestInfo)
-				_, err := mgr.BulkUpdate(requestInfo)
-				if err != nil {
-					//fmt.Println("Error occurred",err)
-					if strings.Contains(err.Error(), "Codelist not found") {
-						requestInfo = "{ \"codeListName\": \"" + mgr.codelist + "\", \"codes\":" + string(val2) + "}"
-						//fmt.Println(requestInfo)
-						_, err := mgr.CreateCodelist(requestInfo)
-						if err != nil {
-							fmt.Println("Error occurred", err)
-						} else {
-							//fmt.Println("Successfully created code list ",mgr.codelist)
-							//fmt.Println(response2)
-							fmt.Println(mgr.codelist, " created.")
-						}
-					}
-				} else {
-					//fmt.Println("Successfully updated codelist -> ",mgr.codelist)
-					//fmt.Println(response)
-					fmt.Println(mgr.codelist, " updated.")
-				}
+		default:
+			err = mgr.updateCodelist(items)
+		}
+		hash := codesHash(apiCodes(items))
+		if err != nil {
+			mgr.journal(journalEntry{Step: stepFailed, List: mgr.codelist, Hash: hash, Detail: err.Error()})
+		} else {
+			mgr.journal(journalEntry{Step: stepApplied, List: mgr.codelist, Hash: hash, Detail: mgr.strategy})
+			if mgr.verifyCodelist(hash) {
+				verified++
 			}
 		}
 		if len(codelistErrors) > 0 {
@@ -324,10 +334,98 @@ func (mgr *apiMgr) runUpdate() error {
 			}
 		}
 	}
+	if verified < len(lists) {
+		mgr.addError(fmt.Sprintf("ERROR: run %s stopped with %d Code List(s) not verified, continue it with \"resume %s\" or undo it with \"rollback %s\"", mgr.run.id, len(lists)-verified, mgr.run.id, mgr.run.id))
+		return fmt.Errorf("Run %s not finished", mgr.run.id)
+	}
+	mgr.journal(journalEntry{Step: stepFinished})
+	fmt.Printf("Run %s finished, %d Code List(s) updated and verified.\n", mgr.run.id, verified)
 	return nil
 	//fmt.Println(clist)
 }
 
+// updateCodelist replaces the codes of the current code list, the code list
+// is created when it does not exist.
+func (mgr *apiMgr) updateCodelist(items []codelistItem) error {
+	err := mgr.BulkUpdate(items)
+	if err != nil {
+		//fmt.Println("Error occurred",err)
+		if strings.Contains(err.Error(), "Codelist not found") {
+			err = mgr.CreateCodelist(items, 0)
+			if err != nil {
+				fmt.Println("Error occurred", err)
+			} else {
+				//fmt.Println("Successfully created code list ",mgr.codelist)
+				fmt.Println(mgr.codelist, " created.")
+			}
+		} else {
+			fmt.Println("Error occurred", err)
+		}
+	} else {
+		//fmt.Println("Successfully updated codelist -> ",mgr.codelist)
+		fmt.Println(mgr.codelist, " updated.")
+	}
+	return err
+}
+
+// readCodelistRows returns the rows of a code list with an action other
+// than No, the columns are found by the titles of the header row.
+func readCodelistRows(name string, rows [][]string, aliases map[string]string, workbook bool) ([]codelistItem, []string) {
+	items := make([]codelistItem, 0)
+	codelistErrors := make([]string, 0)
+	if len(rows) == 0 {
+		return items, codelistErrors
+	}
+	layout, warnings, err := readColumnLayout(rows[0], aliases, workbook)
+	for _, warning := range warnings {
+		fmt.Println(name + ": " + warning)
+	}
+	if err != nil {
+		return items, append(codelistErrors, "ERROR: "+err.Error())
+	}
+	for r, row := range rows[1:] {
+		rownum := r + 2
+		clitem := layout.item(row, rownum)
+		action, ok := normalizeAction(clitem.active)
+		if !ok {
+			codelistErrors = append(codelistErrors, "ERROR: invalid action \""+clitem.active+"\" ignoring at row "+strconv.Itoa(rownum))
+			continue
+		}
+		clitem.active = action
+		if action == actionNo {
+			continue
+		}
+		if clitem.senderCode == "" || (clitem.receiverCode == "" && action != actionDelete && action != actionKeep) {
+			codelistErrors = append(codelistErrors, "ERROR: invalid data (sendercode or receivercode missing) ignoring at row "+strconv.Itoa(rownum))
+			continue
+		}
+		items = append(items, clitem)
+	}
+	return items, codelistErrors
+}
+
+// apiCodes converts the rows of a code list sheet into API codes.
+func apiCodes(items []codelistItem) []b2bapi.Code {
+	codes := make([]b2bapi.Code, 0, len(items))
+	for _, item := range items {
+		codes = append(codes, b2bapi.Code{
+			SenderCode:   item.senderCode,
+			ReceiverCode: item.receiverCode,
+			Description:  item.description,
+			Text1:        item.text[0],
+			Text2:        item.text[1],
+			Text3:        item.text[2],
+			Text4:        item.text[3],
+			Text5:        item.text[4],
+			Text6:        item.text[5],
+			Text7:        item.text[6],
+			Text8:        item.text[7],
+			Text9:        item.text[8],
+		})
+	}
+	return codes
+}
+
 func decrypt(text string) string {
 	if text == "" {
 		return ""
@@ -339,301 +437,173 @@ func decrypt(text string) string {
 	return decrypted
 }
 
-func (mgr *apiMgr) BulkUpdate(payload string) (string, error) {
+func (mgr *apiMgr) BulkUpdate(items []codelistItem) error {
 	codelistid, err := mgr.GetCodelistID()
 	if err != nil {
-		fmt.Println("Failed to get code list item", err)
-		return "", fmt.Errorf("Code list not found")
+		return fmt.Errorf("ERROR - unable to select the version to update [%s]", err)
 	}
 	if len(codelistid) == 0 {
-		return "", fmt.Errorf("Codelist not found")
-	}
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	req, err := http.NewRequest("POST", mgr.apiurl+"/B2BAPIs/svc/codelists/"+codelistid+"/actions/bulkupdatecodes", bytes.NewBuffer([]byte(payload)))
-	req.SetBasicAuth(mgr.username, mgr.password)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("ERROR - API call failed [%s]", err)
+		return fmt.Errorf("Codelist not found")
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	err = mgr.client.BulkUpdateCodes(codelistid, b2bapi.BulkUpdateRequest{ListStatus: 1, Codes: apiCodes(items)})
 	if err != nil {
-		return "", fmt.Errorf("ERROR - Invalid API response [%s]", err)
+		return fmt.Errorf("ERROR - Code List Bulk Update API call failed [%s]", err)
 	}
-	if 200 != resp.StatusCode {
-		return "", fmt.Errorf("ERROR - Invalid API response for Code List Bulk Update API call [%s]", body)
-	}
-	return string(body), nil
+	mgr.recordApplied()
+	return nil
 }
 
-func (mgr *apiMgr) CreateCodelist(payload string) (string, error) {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	req, err := http.NewRequest("POST", mgr.apiurl+"/B2BAPIs/svc/codelists/", bytes.NewBuffer([]byte(payload)))
-	req.SetBasicAuth(mgr.username, mgr.password)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("ERROR - Create Code List API call failed [%s]", err)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+// CreateCodelist creates the current code list, or a new version of it, with
+// the given list status (0 leaves it to B2Bi).
+func (mgr *apiMgr) CreateCodelist(items []codelistItem, listStatus int) error {
+	err := mgr.client.Create(b2bapi.CreateRequest{CodeListName: mgr.codelist, ListStatus: listStatus, Codes: apiCodes(items)})
 	if err != nil {
-		return "", fmt.Errorf("ERROR - Invalid API response for Create Code List API call [%s]", err)
+		return fmt.Errorf("ERROR - Create Code List API call failed [%s]", err)
 	}
-	if 201 != resp.StatusCode {
-		fmt.Println("Response Code", resp.StatusCode)
-		return "", fmt.Errorf("%s", body)
-	}
-	return string(body), nil
+	mgr.recordApplied()
+	return nil
 }
 
+// GetCodelistID returns the _id of the version of the current code list
+// resolved by store.ResolveVersion, empty when the code list does not exist.
 func (mgr *apiMgr) GetCodelistID() (string, error) {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	queryParams := "?locale=en_US&codeListName=" + mgr.codelist + "&_accept=application/json&_contentType=application/json&_exclude=codes"
-	req, err := http.NewRequest("GET", mgr.apiurl+"/B2BAPIs/svc/codelists/"+queryParams, nil)
-	req.SetBasicAuth(mgr.username, mgr.password)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("ERROR - Read Code List API call failed [%s]", err)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	codelists, err := mgr.readCodelists(b2bapi.ListOptions{Name: mgr.codelist, ExcludeCodes: true})
 	if err != nil {
-		return "", fmt.Errorf("ERROR - Invalid API response for Read Code List API Call [%s]", err)
+		return "", err
 	}
-	if 200 != resp.StatusCode {
-		return "", fmt.Errorf("%s", body)
+	codelist, err := store.ResolveVersion(mgr.codelist, codelists)
+	if err == store.ErrNotFound {
+		return "", nil
 	}
-	var codelist interface{}
-	//fmt.Println("body",string(body))
-	err = json.Unmarshal([]byte(string(body)), &codelist)
 	if err != nil {
-		fmt.Println(err)
 		return "", err
 	}
-	data := codelist.([]interface{})
-	//fmt.Println(data[0])
-	for _, value := range data {
-		data2 := value.(map[string]interface{})
-		for k, v := range data2 {
-			switch v := v.(type) {
-			case string:
-				if k == "_id" {
-					return v, nil
-				}
-			}
-		}
-	}
-
-	return "", nil
+	return codelist.ID, nil
 }
 
 func (mgr *apiMgr) backupCodelist() error {
-
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	queryParams := "?locale=en_US&codeListName=" + mgr.codelist + "&_accept=application/json&_contentType=application/json&_exclude=codes"
-	req, err := http.NewRequest("GET", mgr.apiurl+"/B2BAPIs/svc/codelists/"+queryParams, nil)
-	req.SetBasicAuth(mgr.username, mgr.password)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	codelists, err := mgr.fetchCodelists()
 	if err != nil {
 		return err
 	}
-	if 200 != resp.StatusCode {
-		return fmt.Errorf("ERROR - Invalid API response for Read Code List API call [%s]", body)
+	if mgr.backups == nil {
+		mgr.backups = make(map[string][]b2bapi.CodeList)
 	}
-	var codelist interface{}
-	//fmt.Println("body",string(body))
-	err = json.Unmarshal([]byte(string(body)), &codelist)
-	if err != nil {
-		fmt.Println(err)
-		return err
+	mgr.backups[mgr.codelist] = codelists
+	for _, codelist := range codelists {
+		//mgr.showCodeListItem(codelist)
+		mgr.WriteCodeListItem(codelist)
 	}
-	data := codelist.([]interface{})
-	//fmt.Println(data[0])
-	for _, value := range data {
-		data2 := value.(map[string]interface{})
-		codelist2 := &CodeListItem{}
-		codelist2.codeListName = mgr.codelist
-		codelist2.codes = make([]Code, 0)
-		for k, v := range data2 {
-
-			switch v := v.(type) {
-			case string:
-				if k == "_id" {
-					codelist2._id = v
-				}
-				//fmt.Println(k, v, "(string)")
-			case float64:
-				//fmt.Println(k, v, "(float64)")
-				if k == "listStatus" {
-					codelist2.listStatus = v
-				} else if k == "versionNumber" {
-					codelist2.versionNumber = v
-				}
-			case []interface{}:
-				//fmt.Println(k, "(array):")
-
-				for _, u := range v {
-					codeitem, err := mgr.getCodeFromInterface(u)
-					if err != nil {
-						fmt.Println(err)
-					} else if codeitem != nil {
-						codelist2.codes = append(codelist2.codes, *codeitem)
-						//fmt.Println("Got CODE",codeitem)
-					}
-				}
-			default:
-				fmt.Println(k, v, "(unknown)")
-			}
-		}
-		//mgr.showCodeListItem(*codelist2)
-		mgr.WriteCodeListItem(*codelist2)
+	return nil
+}
 
-	}
+// fetchCodelists reads all the versions of the current code list.
+func (mgr *apiMgr) fetchCodelists() ([]b2bapi.CodeList, error) {
+	return mgr.readCodelists(b2bapi.ListOptions{Name: mgr.codelist})
+}
 
-	return nil
+// listCodelists reads all the versions of every code list, without codes.
+func (mgr *apiMgr) listCodelists() ([]b2bapi.CodeList, error) {
+	return mgr.readCodelists(b2bapi.ListOptions{ExcludeCodes: true})
 }
 
-func (mgr *apiMgr) WriteCodeListItem(codelist CodeListItem) {
-	//sheetname:=codelist.codeListName+"#"+strconv.Itoa(int(codelist.versionNumber))
-	sheetname := codelist._id
-	mgr.bkpfileptr.NewSheet(sheetname)
-	mgr.bkpfileptr.SetCellValue(sheetname, "A1", "Action")
-	mgr.bkpfileptr.SetCellValue(sheetname, "B1", "SenderCode")
-	mgr.bkpfileptr.SetCellValue(sheetname, "C1", "ReceiverCode")
-	mgr.bkpfileptr.SetCellValue(sheetname, "D1", "Description")
-	mgr.bkpfileptr.SetCellValue(sheetname, "E1", "Text1")
-	mgr.bkpfileptr.SetCellValue(sheetname, "F1", "Text2")
-	mgr.bkpfileptr.SetCellValue(sheetname, "G1", "Text3")
-	mgr.bkpfileptr.SetCellValue(sheetname, "H1", "Text4")
-	mgr.bkpfileptr.SetCellValue(sheetname, "I1", "Text5")
-	mgr.bkpfileptr.SetCellValue(sheetname, "J1", "Text6")
-	mgr.bkpfileptr.SetCellValue(sheetname, "K1", "Text7")
-	mgr.bkpfileptr.SetCellValue(sheetname, "L1", "Text8")
-	mgr.bkpfileptr.SetCellValue(sheetname, "M1", "Text9")
-	for i := 0; i < len(codelist.codes); i++ {
-		mgr.bkpfileptr.SetCellValue(sheetname, "A"+strconv.Itoa(i+2), "Yes")
-		mgr.bkpfileptr.SetCellValue(sheetname, "B"+strconv.Itoa(i+2), codelist.codes[i].senderCode)
-		mgr.bkpfileptr.SetCellValue(sheetname, "C"+strconv.Itoa(i+2), codelist.codes[i].receiverCode)
-		mgr.bkpfileptr.SetCellValue(sheetname, "D"+strconv.Itoa(i+2), codelist.codes[i].description)
-		mgr.bkpfileptr.SetCellValue(sheetname, "E"+strconv.Itoa(i+2), codelist.codes[i].text1)
-		mgr.bkpfileptr.SetCellValue(sheetname, "F"+strconv.Itoa(i+2), codelist.codes[i].text2)
-		mgr.bkpfileptr.SetCellValue(sheetname, "G"+strconv.Itoa(i+2), codelist.codes[i].text3)
-		mgr.bkpfileptr.SetCellValue(sheetname, "H"+strconv.Itoa(i+2), codelist.codes[i].text4)
-		mgr.bkpfileptr.SetCellValue(sheetname, "I"+strconv.Itoa(i+2), codelist.codes[i].text5)
-		mgr.bkpfileptr.SetCellValue(sheetname, "J"+strconv.Itoa(i+2), codelist.codes[i].text6)
-		mgr.bkpfileptr.SetCellValue(sheetname, "K"+strconv.Itoa(i+2), codelist.codes[i].text7)
-		mgr.bkpfileptr.SetCellValue(sheetname, "L"+strconv.Itoa(i+2), codelist.codes[i].text8)
-		mgr.bkpfileptr.SetCellValue(sheetname, "M"+strconv.Itoa(i+2), codelist.codes[i].text9)
+// readCodelists reads the code lists selected by the options, a name is
+// matched exactly whatever the API returns for it.
+func (mgr *apiMgr) readCodelists(opts b2bapi.ListOptions) ([]b2bapi.CodeList, error) {
+	codelists, err := mgr.client.List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR - Invalid API response for Read Code List API call [%s]", err)
 	}
+	if opts.Name == "" {
+		return codelists, nil
+	}
+	matching := make([]b2bapi.CodeList, 0, len(codelists))
+	for _, codelist := range codelists {
+		if codelist.CodeListName == opts.Name {
+			matching = append(matching, codelist)
+		}
+	}
+	return matching, nil
 }
 
-func (mgr *apiMgr) showCodeListItem(codelist CodeListItem) {
-	fmt.Println("Code List Name ", codelist.codeListName)
-	fmt.Println("List Status", codelist.listStatus)
-	fmt.Println("Version Number", codelist.versionNumber)
-
-	for i := 0; i < len(codelist.codes); i++ {
-		fmt.Println("Sender Code ", codelist.codes[i].senderCode)
-		fmt.Println("Receiver Code ", codelist.codes[i].receiverCode)
-		fmt.Println("Description ", codelist.codes[i].description)
-		for j := 1; j < 9; j++ {
-			switch j {
-			case 1:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text1)
-			case 2:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text2)
-			case 3:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text3)
-			case 4:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text4)
-			case 5:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text5)
-			case 6:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text6)
-			case 7:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text7)
-			case 8:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text8)
-			case 9:
-				fmt.Println("Text"+strconv.Itoa(j), codelist.codes[i].text9)
-			}
+// backupVersionsSheet is the sheet of a backup file listing the versions
+// saved with their list status and the sheet holding their codes, restore
+// activates the version that was active.
+const backupVersionsSheet = "Versions"
 
+func (mgr *apiMgr) WriteCodeListItem(codelist b2bapi.CodeList) {
+	//sheetname:=codelist.codeListName+"#"+strconv.Itoa(int(codelist.versionNumber))
+	f := mgr.bkpfileptr
+	if f.GetSheetIndex(backupVersionsSheet) == 0 {
+		f.NewSheet(backupVersionsSheet)
+		for col, title := range []string{"ID", "Version", "ListStatus", "Created", "User", "Sheet"} {
+			f.SetCellValue(backupVersionsSheet, excelize.ToAlphaString(col)+"1", title)
 		}
 	}
-}
-func (mgr *apiMgr) getCodeFromInterface(in interface{}) (*Code, error) {
-	code := &Code{}
-	code.senderCode = mgr.getCodeField(in, "senderCode")
-	code.receiverCode = mgr.getCodeField(in, "receiverCode")
-	code.description = mgr.getCodeField(in, "description")
-	code.text1 = mgr.getCodeField(in, "text1")
-	code.text2 = mgr.getCodeField(in, "text2")
-	code.text3 = mgr.getCodeField(in, "text3")
-	code.text4 = mgr.getCodeField(in, "text4")
-	code.text5 = mgr.getCodeField(in, "text5")
-	code.text6 = mgr.getCodeField(in, "text6")
-	code.text7 = mgr.getCodeField(in, "text7")
-	code.text8 = mgr.getCodeField(in, "text8")
-	code.text9 = mgr.getCodeField(in, "text9")
-	return code, nil
+	// sheet names are cut to 31 characters and lose some characters, the
+	// _id is only kept in the Versions sheet
+	count := len(f.GetRows(backupVersionsSheet))
+	sheetname := "V" + strconv.Itoa(count)
+	writeCodesSheet(f, sheetname, listSchema(nil).header("Action"), codelist.Codes)
+	row := strconv.Itoa(count + 1)
+	created := ""
+	if !codelist.CreateDate.IsZero() {
+		created = codelist.CreateDate.Format("2006-01-02 15:04:05")
+	}
+	for col, value := range []string{codelist.ID, strconv.Itoa(codelist.VersionNumber), strconv.Itoa(codelist.ListStatus), created, codelist.UserName, sheetname} {
+		f.SetCellValue(backupVersionsSheet, excelize.ToAlphaString(col)+row, value)
+	}
 }
 
-func (mgr *apiMgr) getCodeField(in interface{}, key string) string {
-	obj, ok := in.(map[string]interface{})
-	if ok {
-		if val, ok := obj[key]; ok {
-			return mgr.getString(val)
+// writeCodesSheet writes the codes into a new sheet using the column layout
+// of the input document with the titles of header.
+func writeCodesSheet(f *excelize.File, sheetname string, header []string, codes []b2bapi.Code) {
+	f.NewSheet(sheetname)
+	for col, title := range header {
+		f.SetCellValue(sheetname, excelize.ToAlphaString(col)+"1", title)
+	}
+	for i := 0; i < len(codes); i++ {
+		item := itemFromCode(codes[i])
+		row := append([]string{item.active, item.senderCode}, item.values()...)
+		for col, value := range row {
+			f.SetCellValue(sheetname, excelize.ToAlphaString(col)+strconv.Itoa(i+2), value)
 		}
 	}
-	return ""
 }
 
-func (mgr *apiMgr) getString(in interface{}) string {
-	if str, ok := in.(string); ok {
-		return str
+func (mgr *apiMgr) showCodeListItem(codelist b2bapi.CodeList) {
+	fmt.Println("Code List Name ", codelist.CodeListName)
+	fmt.Println("List Status", codelist.ListStatus)
+	fmt.Println("Version Number", codelist.VersionNumber)
+
+	for _, code := range codelist.Codes {
+		item := itemFromCode(code)
+		fmt.Println("Sender Code ", item.senderCode)
+		fmt.Println("Receiver Code ", item.receiverCode)
+		fmt.Println("Description ", item.description)
+		for j := 1; j <= 9; j++ {
+			fmt.Println("Text"+strconv.Itoa(j), item.text[j-1])
+		}
 	}
-	return ""
 }
 
 func (mgr *apiMgr) deleteCodelist(_id string) error {
-
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	queryParams := _id + "?locale=en_US&codeListName=" + mgr.codelist + "&_accept=application/json&_contentType=application/json&_exclude=codes"
-	req, err := http.NewRequest("DELETE", mgr.apiurl+"/B2BAPIs/svc/codelists/"+queryParams, nil)
-	req.SetBasicAuth(mgr.username, mgr.password)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	err := mgr.client.Delete(_id)
 	if err != nil {
 		return fmt.Errorf("ERROR - Invalid API response for Delete Code List API call [%s]", err)
 	}
-	if 200 != resp.StatusCode {
-		return fmt.Errorf("ERROR - Invalid API response for Delete Code List API call [%s]", body)
-	}
 	return nil
 }
 
+// codelistFailed reports whether one of the _ids is a version of the
+// current code list.
 func (mgr *apiMgr) codelistFailed(codelistArr []string) bool {
 	for _, st := range codelistArr {
-		if strings.Contains(st, mgr.codelist) {
+		name, _, err := parseCodelistID(st)
+		if err != nil {
+			name = st
+		}
+		if name == mgr.codelist {
 			return true
 		}
 	}
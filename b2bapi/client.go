@@ -0,0 +1,425 @@
+// Package b2bapi is a client for the code list REST API of Sterling B2B
+// Integrator (/B2BAPIs/svc/codelists/).
+package b2bapi
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const codelistsPath = "/B2BAPIs/svc/codelists/"
+
+// Client calls the code list API of a B2Bi instance with basic
+// authentication.
+type Client struct {
+	BaseURL    string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+	// Retries is the number of times an idempotent call (GET, HEAD and
+	// DELETE) is retried after a network error or a 429, 502, 503 or 504.
+	Retries int
+	// RetryWait is the wait before the first retry, it doubles with every
+	// retry and half of it is random.
+	RetryWait time.Duration
+	// Logf, when not nil, logs the retries.
+	Logf func(format string, args ...interface{})
+	// PageSize is the number of entries read by a call of List, 1000 when
+	// it is 0.
+	PageSize int
+}
+
+// Options are the connection settings of a client.
+type Options struct {
+	// TLSConfig is the TLS configuration, the system defaults when nil.
+	TLSConfig *tls.Config
+	// ConnectTimeout limits the time to connect to B2Bi, including the TLS
+	// handshake.
+	ConnectTimeout time.Duration
+	// ReadTimeout limits the time of a call, from sending the request to
+	// reading the whole response.
+	ReadTimeout time.Duration
+	Retries     int
+	RetryWait   time.Duration
+	Logf        func(format string, args ...interface{})
+	PageSize    int
+}
+
+var jitter = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// APIError is returned when the API answers with an unexpected status code.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s returned %d [%s]", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// IsNotFound reports whether the error is an API error for a code list that
+// does not exist.
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// NewClient returns a client for the B2Bi instance at baseURL, e.g.
+// https://b2bi.example.com:40084. A zero timeout is no limit.
+func NewClient(baseURL, username, password string, opts Options) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = opts.TLSConfig
+	if opts.ConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = opts.ConnectTimeout
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Username:   username,
+		Password:   password,
+		HTTPClient: &http.Client{Transport: transport, Timeout: opts.ReadTimeout},
+		Retries:    opts.Retries,
+		RetryWait:  opts.RetryWait,
+		Logf:       opts.Logf,
+		PageSize:   opts.PageSize,
+	}
+}
+
+// pathSegment escapes a path segment, e.g. a code list _id. The + is
+// escaped as well since some servers read it as a space.
+func pathSegment(segment string) string {
+	return strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+}
+
+// newRequest builds a request for the path segments below the code list
+// endpoint, every segment and query value is escaped here. The query always
+// asks for JSON and body, when not nil, is sent as JSON.
+func (c *Client) newRequest(method string, segments []string, query url.Values, body interface{}) (*http.Request, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("locale", "en_US")
+	query.Set("_accept", "application/json")
+	query.Set("_contentType", "application/json")
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	escaped := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		escaped = append(escaped, pathSegment(segment))
+	}
+	req, err := http.NewRequest(method, c.BaseURL+codelistsPath+strings.Join(escaped, "/")+"?"+query.Encode(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// do sends the request and decodes the JSON response into out when it is
+// not nil. Any status other than expected is returned as an APIError.
+func (c *Client) do(req *http.Request, expected int, out interface{}) error {
+	_, err := c.doHeader(req, expected, out)
+	return err
+}
+
+// doHeader is do returning the headers of the response. Idempotent requests
+// are retried after a network error or a transient status, a retried
+// DELETE answered with 404 deleted the version before.
+func (c *Client) doHeader(req *http.Request, expected int, out interface{}) (http.Header, error) {
+	retries := 0
+	if req.Method == "GET" || req.Method == "HEAD" || req.Method == "DELETE" {
+		retries = c.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		body, header, err := c.send(req, expected)
+		if attempt > 0 && req.Method == "DELETE" && IsNotFound(err) {
+			return header, nil
+		}
+		if attempt < retries && retryable(err) {
+			wait := c.backoff(attempt)
+			if c.Logf != nil {
+				c.Logf("%s %s failed (%s), retry %d of %d in %s", req.Method, req.URL.Path, err, attempt+1, retries, wait.Round(time.Millisecond))
+			}
+			time.Sleep(wait)
+			if req.GetBody != nil {
+				req.Body, err = req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if out != nil {
+			return header, json.Unmarshal(body, out)
+		}
+		return header, nil
+	}
+}
+
+// send sends the request once and returns the body and the headers of the
+// response.
+func (c *Client) send(req *http.Request, expected int) ([]byte, http.Header, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != expected {
+		return nil, resp.Header, &APIError{Method: req.Method, URL: req.URL.Path, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, resp.Header, nil
+}
+
+// retryable reports whether a call failed with a network error or a status
+// of an overloaded or restarting server. A certificate or TLS error does not
+// go away with a retry.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apiErr, ok := err.(*APIError); ok {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// every error of the HTTP client is a *url.Error, itself a net.Error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var (
+		pinErr      *PinError
+		unknownErr  x509.UnknownAuthorityError
+		invalidErr  x509.CertificateInvalidError
+		hostnameErr x509.HostnameError
+		recordErr   tls.RecordHeaderError
+		opErr       *net.OpError
+		netErr      net.Error
+	)
+	switch {
+	case errors.As(err, &pinErr), errors.As(err, &unknownErr), errors.As(err, &invalidErr),
+		errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return false
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// a TLS alert of the server, e.g. a rejected client certificate
+		return false
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNABORTED):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before a retry, RetryWait doubled for every
+// earlier retry with a random second half.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.RetryWait << uint(attempt)
+	if wait <= 1 {
+		return wait
+	}
+	jitter.Lock()
+	defer jitter.Unlock()
+	return wait/2 + time.Duration(jitter.Int63n(int64(wait/2)))
+}
+
+// Ping checks that the code list endpoint can be reached with the
+// credentials of the client.
+func (c *Client) Ping() error {
+	query := url.Values{}
+	query.Set("_range", "0-0")
+	query.Set("_method", "HEAD")
+	req, err := c.newRequest("HEAD", nil, query, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, http.StatusOK, nil)
+}
+
+// List returns the code list versions selected by the options, without a
+// range every page is read.
+func (c *Client) List(opts ListOptions) ([]CodeList, error) {
+	if opts.Range != "" {
+		codelists, _, err := c.listPage(opts)
+		return codelists, err
+	}
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	codelists := make([]CodeList, 0)
+	seen := make(map[string]bool)
+	for start := 0; ; {
+		opts.Range = fmt.Sprintf("%d-%d", start, start+pageSize-1)
+		page, header, err := c.listPage(opts)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, codelist := range page {
+			key := codelist.CodeListName + "|||" + strconv.Itoa(codelist.VersionNumber)
+			if !seen[key] {
+				seen[key] = true
+				codelists = append(codelists, codelist)
+				added++
+			}
+		}
+		// an empty page ends the listing, a server ignoring the range
+		// returns the same entries again
+		if added == 0 {
+			break
+		}
+		// a server may serve less than the range asked for, the total of
+		// the Content-Range tells when the last page is read, without it
+		// the pages are read until one adds nothing
+		total, ok := contentRangeTotal(header.Get("Content-Range"))
+		if ok && start+len(page) >= total {
+			break
+		}
+		start += len(page)
+	}
+	return codelists, nil
+}
+
+// listPage reads the code list versions of the range of the options.
+func (c *Client) listPage(opts ListOptions) ([]CodeList, http.Header, error) {
+	query := url.Values{}
+	if opts.Name != "" {
+		query.Set("codeListName", opts.Name)
+	}
+	if opts.Range != "" {
+		query.Set("_range", opts.Range)
+	}
+	if opts.ExcludeCodes {
+		query.Set("_exclude", "codes")
+	}
+	req, err := c.newRequest("GET", nil, query, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	codelists := make([]CodeList, 0)
+	header, err := c.doHeader(req, http.StatusOK, &codelists)
+	if err != nil {
+		return nil, nil, err
+	}
+	return codelists, header, nil
+}
+
+var contentRange = regexp.MustCompile(`(\d+)-(\d+)/(\d+)`)
+
+// contentRangeTotal returns the total of a Content-Range header, e.g.
+// items 0-999/1400.
+func contentRangeTotal(value string) (int, bool) {
+	match := contentRange.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	total, err := strconv.Atoi(match[3])
+	return total, err == nil
+}
+
+// Get returns a code list version by its ID (name|||version).
+func (c *Client) Get(id string) (*CodeList, error) {
+	req, err := c.newRequest("GET", []string{id}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	codelist := &CodeList{}
+	err = c.do(req, http.StatusOK, codelist)
+	if err != nil {
+		return nil, err
+	}
+	return codelist, nil
+}
+
+// GetVersions returns every version of the named code list sorted by
+// version number.
+func (c *Client) GetVersions(name string) ([]CodeList, error) {
+	codelists, err := c.List(ListOptions{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]CodeList, 0, len(codelists))
+	for _, codelist := range codelists {
+		if codelist.CodeListName == name {
+			versions = append(versions, codelist)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNumber < versions[j].VersionNumber })
+	return versions, nil
+}
+
+// Create creates a code list, or a new version of an existing one.
+func (c *Client) Create(create CreateRequest) error {
+	req, err := c.newRequest("POST", nil, nil, create)
+	if err != nil {
+		return err
+	}
+	return c.do(req, http.StatusCreated, nil)
+}
+
+// BulkUpdateCodes replaces the codes of a code list version.
+func (c *Client) BulkUpdateCodes(id string, update BulkUpdateRequest) error {
+	req, err := c.newRequest("POST", []string{id, "actions", "bulkupdatecodes"}, nil, update)
+	if err != nil {
+		return err
+	}
+	return c.do(req, http.StatusOK, nil)
+}
+
+// Update changes the list status of a code list version.
+func (c *Client) Update(id string, update UpdateRequest) error {
+	req, err := c.newRequest("PUT", []string{id}, nil, update)
+	if err != nil {
+		return err
+	}
+	return c.do(req, http.StatusOK, nil)
+}
+
+// Delete deletes a code list version.
+func (c *Client) Delete(id string) error {
+	req, err := c.newRequest("DELETE", []string{id}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, http.StatusOK, nil)
+}
@@ -0,0 +1,520 @@
+package b2bapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var hostileNames = []string{
+	"R&D Supplies #2",
+	"a+b=c",
+	"100% cotton",
+	"Ünïcødé 名前",
+	"path/with/slashes",
+	"?query=1&x=2",
+	"semi;colon,comma",
+	"  spaces  ",
+	"pipes|||99",
+	"back\\slash",
+	"quote\"and'apostrophe",
+	"tab\tand~tilde",
+}
+
+// fakeServer is a code list endpoint keeping the code list versions in
+// memory, the path segments and query values are decoded from the raw URL
+// so that a badly escaped request does not find its code list.
+type fakeServer struct {
+	sync.Mutex
+	codelists map[string]CodeList
+	rawPaths  []string
+	// faults are the statuses answered to the next requests of a method,
+	// a lost fault handles the request and answers with the status.
+	faults map[string][]fault
+	// requests counts the requests by method.
+	requests map[string]int
+	// ranged serves the _range of a list, with a Content-Range header
+	// when contentRange is set and at most maxPage entries when it is set.
+	ranged       bool
+	contentRange bool
+	maxPage      int
+}
+
+type fault struct {
+	status int
+	lost   bool
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *Client) {
+	fake := &fakeServer{codelists: make(map[string]CodeList), faults: make(map[string][]fault), requests: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, NewClient(server.URL, "user", "password", Options{})
+}
+
+func (f *fakeServer) reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests[r.Method]++
+	if faults := f.faults[r.Method]; len(faults) > 0 {
+		f.faults[r.Method] = faults[1:]
+		if faults[0].lost {
+			f.handle(httptest.NewRecorder(), r)
+		}
+		f.reply(w, faults[0].status, "fault")
+		return
+	}
+	f.handle(w, r)
+}
+
+func (f *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	rawPath := r.URL.EscapedPath()
+	f.rawPaths = append(f.rawPaths, rawPath)
+	if !strings.HasPrefix(rawPath, codelistsPath) {
+		f.reply(w, http.StatusNotFound, nil)
+		return
+	}
+	segments := make([]string, 0)
+	for _, raw := range strings.Split(strings.TrimPrefix(rawPath, codelistsPath), "/") {
+		if raw == "" {
+			continue
+		}
+		segment, err := url.PathUnescape(raw)
+		if err != nil {
+			f.reply(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		segments = append(segments, segment)
+	}
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		f.reply(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case r.Method == "HEAD" && len(segments) == 0:
+		f.reply(w, http.StatusOK, nil)
+	case r.Method == "GET" && len(segments) == 0:
+		codelists := make([]CodeList, 0)
+		for _, codelist := range f.codelists {
+			if name, ok := query["codeListName"]; !ok || name[0] == codelist.CodeListName {
+				codelists = append(codelists, codelist)
+			}
+		}
+		sort.Slice(codelists, func(i, j int) bool { return codelists[i].ID < codelists[j].ID })
+		if rng := query.Get("_range"); f.ranged && rng != "" {
+			var start, end int
+			fmt.Sscanf(rng, "%d-%d", &start, &end)
+			total := len(codelists)
+			if f.maxPage > 0 && end-start >= f.maxPage {
+				end = start + f.maxPage - 1
+			}
+			if start > total {
+				start = total
+			}
+			if end >= total {
+				end = total - 1
+			}
+			codelists = codelists[start : end+1]
+			if f.contentRange {
+				w.Header().Set("Content-Range", fmt.Sprintf("items %d-%d/%d", start, end, total))
+			}
+		}
+		f.reply(w, http.StatusOK, codelists)
+	case r.Method == "GET" && len(segments) == 1:
+		codelist, ok := f.codelists[segments[0]]
+		if !ok {
+			f.reply(w, http.StatusNotFound, "not found")
+			return
+		}
+		f.reply(w, http.StatusOK, codelist)
+	case r.Method == "POST" && len(segments) == 0:
+		var create CreateRequest
+		json.NewDecoder(r.Body).Decode(&create)
+		version := 1
+		for _, codelist := range f.codelists {
+			if codelist.CodeListName == create.CodeListName && codelist.VersionNumber >= version {
+				version = codelist.VersionNumber + 1
+			}
+		}
+		id := create.CodeListName + "|||" + strconv.Itoa(version)
+		f.codelists[id] = CodeList{ID: id, CodeListName: create.CodeListName, VersionNumber: version, ListStatus: 1, Codes: create.Codes}
+		f.reply(w, http.StatusCreated, nil)
+	case r.Method == "POST" && len(segments) == 3 && segments[1] == "actions" && segments[2] == "bulkupdatecodes":
+		codelist, ok := f.codelists[segments[0]]
+		if !ok {
+			f.reply(w, http.StatusNotFound, "not found")
+			return
+		}
+		var update BulkUpdateRequest
+		json.NewDecoder(r.Body).Decode(&update)
+		codelist.Codes = update.Codes
+		f.codelists[segments[0]] = codelist
+		f.reply(w, http.StatusOK, nil)
+	case r.Method == "DELETE" && len(segments) == 1:
+		if _, ok := f.codelists[segments[0]]; !ok {
+			f.reply(w, http.StatusNotFound, "not found")
+			return
+		}
+		delete(f.codelists, segments[0])
+		f.reply(w, http.StatusOK, nil)
+	default:
+		f.reply(w, http.StatusBadRequest, "unexpected "+r.Method+" "+rawPath)
+	}
+}
+
+func TestHostileNames(t *testing.T) {
+	for _, name := range hostileNames {
+		t.Run(name, func(t *testing.T) {
+			fake, client := newFakeServer(t)
+			other := name + " other"
+			for _, create := range []string{name, other, name} {
+				err := client.Create(CreateRequest{CodeListName: create, Codes: []Code{{SenderCode: "S", ReceiverCode: create}}})
+				if err != nil {
+					t.Fatalf("Create(%q): %v", create, err)
+				}
+			}
+
+			versions, err := client.GetVersions(name)
+			if err != nil {
+				t.Fatalf("GetVersions: %v", err)
+			}
+			if len(versions) != 2 || versions[0].VersionNumber != 1 || versions[1].VersionNumber != 2 {
+				t.Fatalf("GetVersions returned %+v, want versions 1 and 2 of %q", versions, name)
+			}
+			id := versions[1].ID
+
+			codelist, err := client.Get(id)
+			if err != nil {
+				t.Fatalf("Get(%q): %v", id, err)
+			}
+			if codelist.CodeListName != name {
+				t.Errorf("Get(%q) returned code list %q", id, codelist.CodeListName)
+			}
+
+			err = client.BulkUpdateCodes(id, BulkUpdateRequest{ListStatus: 1, Codes: []Code{{SenderCode: "S2", ReceiverCode: "R2"}}})
+			if err != nil {
+				t.Fatalf("BulkUpdateCodes(%q): %v", id, err)
+			}
+			codelist, err = client.Get(id)
+			if err != nil || len(codelist.Codes) != 1 || codelist.Codes[0].SenderCode != "S2" {
+				t.Errorf("BulkUpdateCodes(%q) did not update the codes: %+v, %v", id, codelist, err)
+			}
+
+			err = client.Delete(id)
+			if err != nil {
+				t.Fatalf("Delete(%q): %v", id, err)
+			}
+			if _, ok := fake.codelists[id]; ok {
+				t.Errorf("Delete(%q) left the version in place", id)
+			}
+			if _, ok := fake.codelists[other+"|||1"]; !ok {
+				t.Errorf("Delete(%q) removed %q", id, other)
+			}
+			err = client.Delete(id)
+			if !IsNotFound(err) {
+				t.Errorf("second Delete(%q) returned %v, want a not found error", id, err)
+			}
+
+			for _, rawPath := range fake.rawPaths {
+				if strings.ContainsAny(strings.TrimPrefix(rawPath, codelistsPath), " #?+|") {
+					t.Errorf("unescaped character in path %q", rawPath)
+				}
+			}
+		})
+	}
+}
+
+func TestListQueryEscaping(t *testing.T) {
+	fake, client := newFakeServer(t)
+	for _, name := range hostileNames {
+		fake.codelists[name+"|||1"] = CodeList{ID: name + "|||1", CodeListName: name, VersionNumber: 1, ListStatus: 1}
+	}
+	for _, name := range hostileNames {
+		codelists, err := client.List(ListOptions{Name: name, ExcludeCodes: true})
+		if err != nil {
+			t.Fatalf("List(%q): %v", name, err)
+		}
+		if len(codelists) != 1 || codelists[0].CodeListName != name {
+			t.Errorf("List(%q) returned %+v", name, codelists)
+		}
+	}
+	codelists, err := client.List(ListOptions{ExcludeCodes: true})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(codelists) != len(hostileNames) {
+		t.Errorf("List returned %d code lists, want %d", len(codelists), len(hostileNames))
+	}
+}
+
+func TestPathSegment(t *testing.T) {
+	tests := map[string]string{
+		"plain":           "plain",
+		"R&D Supplies #2": "R&D%20Supplies%20%232",
+		"a+b":             "a%2Bb",
+		"a/b|||1":         "a%2Fb%7C%7C%7C1",
+		"é":               "%C3%A9",
+	}
+	for segment, want := range tests {
+		if got := pathSegment(segment); got != want {
+			t.Errorf("pathSegment(%q) = %q, want %q", segment, got, want)
+		}
+	}
+}
+
+// addCodelists adds one version of n code lists named List000 and up.
+func (f *fakeServer) addCodelists(n int) {
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("List%03d", i)
+		f.codelists[name+"|||1"] = CodeList{ID: name + "|||1", CodeListName: name, VersionNumber: 1, ListStatus: 1}
+	}
+}
+
+func TestListPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		entries      int
+		ranged       bool
+		contentRange bool
+		maxPage      int
+		want         int
+		wantRequests int
+	}{
+		{"short page", 25, true, false, 0, 25, 4},
+		{"empty last page", 20, true, false, 0, 20, 3},
+		{"content range total", 20, true, true, 0, 20, 2},
+		{"content range short page", 25, true, true, 0, 25, 3},
+		{"range ignored", 10, false, false, 0, 10, 2},
+		{"range ignored short page", 25, false, false, 0, 25, 2},
+		{"single page", 3, true, true, 0, 3, 1},
+		{"no code list", 0, true, false, 0, 0, 1},
+		{"capped pages", 25, true, true, 4, 25, 7},
+		{"capped pages without total", 25, true, false, 4, 25, 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, client := newFakeServer(t)
+			fake.ranged = test.ranged
+			fake.contentRange = test.contentRange
+			fake.maxPage = test.maxPage
+			fake.addCodelists(test.entries)
+			client.PageSize = 10
+			codelists, err := client.List(ListOptions{ExcludeCodes: true})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(codelists) != test.want {
+				t.Errorf("List returned %d code lists, want %d", len(codelists), test.want)
+			}
+			seen := make(map[string]bool)
+			for _, codelist := range codelists {
+				if seen[codelist.ID] {
+					t.Errorf("List returned %s twice", codelist.ID)
+				}
+				seen[codelist.ID] = true
+			}
+			if fake.requests["GET"] != test.wantRequests {
+				t.Errorf("List sent %d requests, want %d", fake.requests["GET"], test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestListRange(t *testing.T) {
+	fake, client := newFakeServer(t)
+	fake.ranged = true
+	fake.addCodelists(25)
+	client.PageSize = 10
+	codelists, err := client.List(ListOptions{Range: "5-9", ExcludeCodes: true})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(codelists) != 5 || codelists[0].CodeListName != "List005" || fake.requests["GET"] != 1 {
+		t.Errorf("List with a range returned %d code lists from %+v in %d requests", len(codelists), codelists, fake.requests["GET"])
+	}
+}
+
+// newRetryClient returns a client of the fake server retrying 3 times and
+// counting the retries logged.
+func newRetryClient(t *testing.T) (*fakeServer, *Client, *int) {
+	fake, client := newFakeServer(t)
+	client.Retries = 3
+	client.RetryWait = time.Millisecond
+	logged := 0
+	client.Logf = func(format string, args ...interface{}) { logged++ }
+	return fake, client, &logged
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		faults       []fault
+		call         func(*Client) error
+		wantErr      bool
+		wantRequests int
+	}{
+		{"GET transient", "GET", []fault{{status: 503}, {status: 429}}, getList, false, 3},
+		{"GET gateway", "GET", []fault{{status: 502}, {status: 504}, {status: 503}}, getList, false, 4},
+		{"GET retries exhausted", "GET", []fault{{status: 503}, {status: 503}, {status: 503}, {status: 503}}, getList, true, 4},
+		{"GET not transient", "GET", []fault{{status: 500}}, getList, true, 1},
+		{"HEAD transient", "HEAD", []fault{{status: 503}}, func(c *Client) error { return c.Ping() }, false, 2},
+		{"POST not retried", "POST", []fault{{status: 503}}, createList, true, 1},
+		{"DELETE transient", "DELETE", []fault{{status: 503}}, deleteList, false, 2},
+		{"DELETE response lost", "DELETE", []fault{{status: 503, lost: true}}, deleteList, false, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, client, logged := newRetryClient(t)
+			fake.codelists["A|||1"] = CodeList{ID: "A|||1", CodeListName: "A", VersionNumber: 1, ListStatus: 1}
+			fake.faults[test.method] = test.faults
+			err := test.call(client)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if fake.requests[test.method] != test.wantRequests {
+				t.Errorf("sent %d %s requests, want %d", fake.requests[test.method], test.method, test.wantRequests)
+			}
+			if *logged != test.wantRequests-1 {
+				t.Errorf("logged %d retries, want %d", *logged, test.wantRequests-1)
+			}
+		})
+	}
+}
+
+// getList reads a single page, the retries are counted per request.
+func getList(c *Client) error {
+	_, err := c.List(ListOptions{Name: "A", Range: "0-999"})
+	return err
+}
+
+func createList(c *Client) error {
+	return c.Create(CreateRequest{CodeListName: "B", Codes: []Code{{SenderCode: "S", ReceiverCode: "R"}}})
+}
+
+func deleteList(c *Client) error {
+	return c.Delete("A|||1")
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	_, client, _ := newRetryClient(t)
+	err := client.Delete("missing|||1")
+	if !IsNotFound(err) {
+		t.Errorf("Delete of a missing version returned %v, want a not found error", err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transient status", &APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"server error", &APIError{StatusCode: http.StatusInternalServerError}, false},
+		{"connection refused", &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, true},
+		{"connection reset", &url.Error{Op: "Get", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, true},
+		{"connection closed", &url.Error{Op: "Get", Err: io.EOF}, true},
+		{"body cut", io.ErrUnexpectedEOF, true},
+		{"timeout", &url.Error{Op: "Get", Err: context.DeadlineExceeded}, true},
+		{"unknown authority", &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}, false},
+		{"invalid certificate", &url.Error{Op: "Get", Err: x509.CertificateInvalidError{}}, false},
+		{"host name", &url.Error{Op: "Get", Err: x509.HostnameError{}}, false},
+		{"not TLS", &url.Error{Op: "Get", Err: tls.RecordHeaderError{}}, false},
+		{"not pinned", &url.Error{Op: "Get", Err: &PinError{Fingerprint: "00"}}, false},
+		{"TLS alert", &url.Error{Op: "Get", Err: &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}}, false},
+		{"invalid URL", &url.Error{Op: "parse", Err: errors.New("invalid port")}, false},
+		{"other error", errors.New("invalid character"), false},
+	}
+	for _, test := range tests {
+		if got := retryable(test.err); got != test.want {
+			t.Errorf("%s: retryable(%v) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close()
+
+	fake := &fakeServer{codelists: make(map[string]CodeList), faults: make(map[string][]fault), requests: make(map[string]int)}
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+	pinned, err := TLSOptions{Insecure: true, Fingerprints: []string{Fingerprint(server.Certificate().Raw)}}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	notPinned, err := TLSOptions{Insecure: true, Fingerprints: []string{strings.Repeat("00", 32)}}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		tlsConfig *tls.Config
+		wantErr   bool
+		retries   int
+	}{
+		{"connection refused", closed, nil, true, 3},
+		{"unknown authority", server.URL, nil, true, 0},
+		{"not pinned", server.URL, notPinned, true, 0},
+		{"pinned", server.URL, pinned, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := NewClient(test.url, "user", "password", Options{TLSConfig: test.tlsConfig, Retries: 3, RetryWait: time.Millisecond})
+			logged := 0
+			client.Logf = func(format string, args ...interface{}) { logged++ }
+			err := getList(client)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if logged != test.retries {
+				t.Errorf("retried %d times, want %d (%v)", logged, test.retries, err)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	client := &Client{RetryWait: 100 * time.Millisecond}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			wait := client.backoff(attempt)
+			if wait < want/2 || wait >= want {
+				t.Fatalf("backoff(%d) = %s, want from %s to %s", attempt, wait, want/2, want)
+			}
+		}
+	}
+	client.RetryWait = 0
+	if wait := client.backoff(2); wait != 0 {
+		t.Errorf("backoff without a wait = %s, want 0", wait)
+	}
+}
@@ -0,0 +1,114 @@
+package b2bapi
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TimeFormat is the layout of the dates of the API.
+const TimeFormat = "2006-01-02T15:04:05.000-0700"
+
+// Timestamp is a date of the API, e.g. 2019-05-16T17:08:52.000+0000.
+type Timestamp struct {
+	time.Time
+}
+
+// MarshalJSON writes the date using TimeFormat, a zero date is null.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Format(TimeFormat))
+}
+
+// UnmarshalJSON reads a date in TimeFormat or RFC 3339.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	t.Time = time.Time{}
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.Parse(TimeFormat, value)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// Code is an entry of a code list, the sender code is the key of the entry.
+type Code struct {
+	SenderCode   string `json:"senderCode"`
+	ReceiverCode string `json:"receiverCode"`
+	Description  string `json:"description,omitempty"`
+	Text1        string `json:"text1,omitempty"`
+	Text2        string `json:"text2,omitempty"`
+	Text3        string `json:"text3,omitempty"`
+	Text4        string `json:"text4,omitempty"`
+	Text5        string `json:"text5,omitempty"`
+	Text6        string `json:"text6,omitempty"`
+	Text7        string `json:"text7,omitempty"`
+	Text8        string `json:"text8,omitempty"`
+	Text9        string `json:"text9,omitempty"`
+}
+
+// CodeList is a version of a code list as returned by the API, the ID is
+// the code list name and the version number joined by "|||".
+//
+//	{
+//	  "_id": "Zydus_SAP_Cust|||1",
+//	  "codeListName": "Zydus_SAP_Cust",
+//	  "versionNumber": 1,
+//	  "createDate": "2019-05-16T17:08:52.000+0000",
+//	  "userName": "apiuser",
+//	  "listStatus": 1,
+//	  "codes": [ { "senderCode": "test1", "receiverCode": "testre", "description": "no test" } ]
+//	}
+type CodeList struct {
+	ID            string    `json:"_id"`
+	CodeListName  string    `json:"codeListName"`
+	VersionNumber int       `json:"versionNumber"`
+	CreateDate    Timestamp `json:"createDate"`
+	UserName      string    `json:"userName,omitempty"`
+	ListStatus    int       `json:"listStatus"`
+	Codes         []Code    `json:"codes,omitempty"`
+}
+
+// CreateRequest is the body of a Create call. Creating a code list that
+// already exists adds a new version to it.
+type CreateRequest struct {
+	CodeListName string `json:"codeListName"`
+	ListStatus   int    `json:"listStatus,omitempty"`
+	Codes        []Code `json:"codes"`
+}
+
+// BulkUpdateRequest is the body of a BulkUpdateCodes call, the codes replace
+// all the codes of the code list version.
+type BulkUpdateRequest struct {
+	ListStatus int    `json:"listStatus,omitempty"`
+	Codes      []Code `json:"codes"`
+}
+
+// UpdateRequest is the body of an Update call, a list status of 1 makes the
+// version the active one.
+type UpdateRequest struct {
+	ListStatus int `json:"listStatus"`
+}
+
+// ListOptions selects the code lists returned by List.
+type ListOptions struct {
+	// Name returns the versions of a single code list when set.
+	Name string
+	// Range is the range of entries to return, e.g. "0-999", every entry
+	// is returned page by page when it is empty.
+	Range string
+	// ExcludeCodes leaves the codes out of the response.
+	ExcludeCodes bool
+}
@@ -0,0 +1,119 @@
+package b2bapi
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOptions are the settings of the TLS connections to B2Bi.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of the certificate authorities trusted in
+	// place of the system ones.
+	CAFile string
+	// Fingerprints are the SHA-256 fingerprints, in hex with or without
+	// colons, one of which the server certificate must have.
+	Fingerprints []string
+	// CertFile and KeyFile are the PEM client certificate and key sent to
+	// B2Bi for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// MinVersion is the lowest TLS version accepted: 1.0, 1.1, 1.2 (the
+	// default) or 1.3.
+	MinVersion string
+	// Insecure skips the verification of the server certificate chain,
+	// the fingerprints are still checked.
+	Insecure bool
+}
+
+// NormalizeFingerprint returns a SHA-256 fingerprint in lower case hex
+// without colons, e.g. for AB:CD:... or abcd....
+func NormalizeFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	if decoded, err := hex.DecodeString(normalized); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fingerprint)
+	}
+	return normalized, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER certificate.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// PinError is returned when the server certificate is not pinned.
+type PinError struct {
+	Fingerprint string
+}
+
+func (e *PinError) Error() string {
+	if e.Fingerprint == "" {
+		return "no server certificate"
+	}
+	return fmt.Sprintf("server certificate fingerprint %s is not pinned", e.Fingerprint)
+}
+
+// Config returns the TLS configuration of the options.
+func (opts TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.Insecure}
+	if opts.MinVersion != "" {
+		version, ok := tlsVersions[opts.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum TLS version %q (1.0, 1.1, 1.2 or 1.3)", opts.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, fmt.Errorf("a client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(opts.Fingerprints) > 0 {
+		pins := make(map[string]bool)
+		for _, fingerprint := range opts.Fingerprints {
+			normalized, err := NormalizeFingerprint(fingerprint)
+			if err != nil {
+				return nil, err
+			}
+			pins[normalized] = true
+		}
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return &PinError{}
+			}
+			if fingerprint := Fingerprint(rawCerts[0]); !pins[fingerprint] {
+				return &PinError{Fingerprint: fingerprint}
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
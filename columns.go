@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"gopkg.in/ini.v1"
+	"strconv"
+	"strings"
+)
+
+// fieldNames are the columns of a code list sheet in their default order.
+var fieldNames = []string{"action", "senderCode", "receiverCode", "description", "text1", "text2", "text3", "text4", "text5", "text6", "text7", "text8", "text9"}
+
+// requiredFields are the columns a code list sheet can not be read without,
+// without an action column every row of a CSV or reconcile file is loaded
+// (Yes). A workbook must have its action column.
+var requiredFields = []string{"senderCode", "receiverCode"}
+
+// columnLayout maps a field name to the index of its column in the sheet.
+type columnLayout map[string]int
+
+// columnTitle normalizes a header title, "Sender Code" and "sender_code"
+// are the same column.
+func columnTitle(title string) string {
+	title = strings.ToLower(strings.TrimSpace(title))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(title)
+}
+
+// loadColumnAliases returns the header titles of the fields, the defaults
+// are the field names and Active for the action. More titles can be given
+// in the [columns] section of the configuration file (config may be nil):
+//
+//	[columns]
+//	senderCode = Sender, Partner Code
+//	receiverCode = SAP Code
+func loadColumnAliases(config *ini.File) (map[string]string, []string) {
+	aliases := map[string]string{columnTitle("Active"): "action"}
+	for _, field := range fieldNames {
+		aliases[columnTitle(field)] = field
+	}
+	aliasErrors := make([]string, 0)
+	if config == nil {
+		return aliases, aliasErrors
+	}
+	sec, err := config.GetSection("columns")
+	if err != nil {
+		return aliases, aliasErrors
+	}
+	for _, key := range sec.Keys() {
+		field := aliases[columnTitle(key.Name())]
+		if field == "" || columnTitle(key.Name()) != columnTitle(field) {
+			aliasErrors = append(aliasErrors, "ERROR: [columns] unknown field "+key.Name())
+			continue
+		}
+		for _, title := range splitList(key.String()) {
+			if other, ok := aliases[columnTitle(title)]; ok && other != field {
+				aliasErrors = append(aliasErrors, "ERROR: [columns] \""+title+"\" is already the title of "+other)
+				continue
+			}
+			aliases[columnTitle(title)] = field
+		}
+	}
+	return aliases, aliasErrors
+}
+
+// readColumnLayout finds the columns of the fields in the header row, the
+// warnings are returned for the columns that are ignored. The header of a
+// workbook must have the action column, a renamed Active column would load
+// the rows marked No.
+func readColumnLayout(header []string, aliases map[string]string, workbook bool) (columnLayout, []string, error) {
+	layout := make(columnLayout)
+	warnings := make([]string, 0)
+	for col, title := range header {
+		if strings.TrimSpace(title) == "" {
+			continue
+		}
+		cell := excelize.ToAlphaString(col) + "1"
+		field, ok := aliases[columnTitle(title)]
+		if !ok {
+			warnings = append(warnings, "WARNING: unknown column \""+title+"\" in "+cell+" ignored")
+			continue
+		}
+		if first, ok := layout[field]; ok {
+			return nil, warnings, fmt.Errorf("column %s in %s is already in %s", field, cell, excelize.ToAlphaString(first)+"1")
+		}
+		layout[field] = col
+	}
+	missing := make([]string, 0)
+	if _, ok := layout["action"]; workbook && !ok {
+		missing = append(missing, "action")
+	}
+	for _, field := range requiredFields {
+		if _, ok := layout[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, warnings, fmt.Errorf("missing column(s) %s in the header row", strings.Join(missing, ", "))
+	}
+	return layout, warnings, nil
+}
+
+// value returns the value of a field in a row, rows are shorter than the
+// header when their last cells are empty.
+func (layout columnLayout) value(row []string, field string) string {
+	col, ok := layout[field]
+	if !ok || col >= len(row) {
+		return ""
+	}
+	return row[col]
+}
+
+// cell returns the reference of the cell of a field, e.g. B5.
+func (layout columnLayout) cell(field string, rownum int) string {
+	return excelize.ToAlphaString(layout[field]) + strconv.Itoa(rownum)
+}
+
+// item returns the code list item of a row.
+func (layout columnLayout) item(row []string, rownum int) codelistItem {
+	item := codelistItem{row: rownum, active: actionYes}
+	if _, ok := layout["action"]; ok {
+		item.active = layout.value(row, "action")
+	}
+	item.senderCode = layout.value(row, "senderCode")
+	item.receiverCode = layout.value(row, "receiverCode")
+	item.description = layout.value(row, "description")
+	for i := 1; i <= 9; i++ {
+		item.text[i-1] = layout.value(row, "text"+strconv.Itoa(i))
+	}
+	return item
+}
+
+// checkLayouts adds the errors of the header rows of the code lists, it is
+// called before any change so that a sheet without its header or required
+// columns does not load an empty code list.
+func (mgr *apiMgr) checkLayouts(lists []inputList) bool {
+	valid := true
+	for _, list := range lists {
+		if len(list.rows) == 0 {
+			mgr.addError("ERROR: Code List \"" + list.name + "\" has no header row")
+			valid = false
+			continue
+		}
+		_, _, err := readColumnLayout(list.rows[0], mgr.listColumns(list.name), list.workbook)
+		if err != nil {
+			mgr.addError("ERROR: Code List \"" + list.name + "\" " + err.Error())
+			valid = false
+		}
+	}
+	return valid
+}
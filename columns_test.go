@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckLayouts(t *testing.T) {
+	columns, _ := loadColumnAliases(nil)
+	tests := []struct {
+		name     string
+		rows     [][]string
+		workbook bool
+		valid    bool
+		want     string
+	}{
+		{"default titles", [][]string{{"Active", "SenderCode", "ReceiverCode"}, {"Yes", "A", "RA"}}, false, true, ""},
+		{"no action column", [][]string{{"SenderCode", "ReceiverCode", "Text1"}}, false, true, ""},
+		{"unknown column", [][]string{{"SenderCode", "ReceiverCode", "Notes"}}, false, true, ""},
+		{"missing receiver code", [][]string{{"Active", "SenderCode", "Receiver"}, {"Yes", "A", "RA"}}, false, false, "missing column(s) receiverCode"},
+		{"missing both codes", [][]string{{"Code", "Value"}, {"A", "RA"}}, false, false, "missing column(s) senderCode, receiverCode"},
+		{"duplicate column", [][]string{{"SenderCode", "ReceiverCode", "SenderCode"}}, false, false, "already in A1"},
+		{"no header row", nil, false, false, "has no header row"},
+		{"workbook titles", [][]string{{"Active", "SenderCode", "ReceiverCode", "Text1"}, {"No", "A", "RA"}}, true, true, ""},
+		{"workbook without action column", [][]string{{"SenderCode", "ReceiverCode"}, {"A", "RA"}}, true, false, "missing column(s) action"},
+		{"workbook renamed action column", [][]string{{"Enabled", "SenderCode", "ReceiverCode"}, {"No", "A", "RA"}}, true, false, "missing column(s) action"},
+		{"workbook unknown column", [][]string{{"Active", "SenderCode", "ReceiverCode", "Comments"}, {"Yes", "A", "RA", "checked"}}, true, true, ""},
+	}
+	for _, test := range tests {
+		mgr := &apiMgr{columns: columns}
+		valid := mgr.checkLayouts([]inputList{{name: "LIST", rows: test.rows, workbook: test.workbook}})
+		if valid != test.valid {
+			t.Errorf("%s: checkLayouts = %v, want %v (%v)", test.name, valid, test.valid, mgr.errorsList)
+			continue
+		}
+		if !test.valid && (len(mgr.errorsList) != 1 || !strings.Contains(mgr.errorsList[0], test.want) || !strings.Contains(mgr.errorsList[0], "\"LIST\"")) {
+			t.Errorf("%s: errors %v, want one error with %q", test.name, mgr.errorsList, test.want)
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bufio"
+	"codelistmgr/store"
+	"fmt"
+	"golang.org/x/term"
+	"gopkg.in/ini.v1"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+const formatUsage = "input format: xlsx, csv, tsv, dir, json, yaml or xml (default by the file extension)"
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{"update", "update the Code Lists on B2Bi from an input document", updateCommand},
+	{"export", "export Code Lists from B2Bi into a workbook", exportCommand},
+	{"convert", "convert an input document into a workbook or a resource manager XML file", convertCommand},
+	{"restore", "recreate the Code Lists saved in a backup file", restoreCommand},
+	{"resume", "continue an update run that stopped before it finished", resumeCommand},
+	{"rollback", "restore the Code Lists changed by an update run from its backup", rollbackCommand},
+	{"diff", "compare an input document with the Code Lists on B2Bi", diffCommand},
+	{"validate", "check an input document without connecting to B2Bi", validateCommand},
+	{"encrypt", "encrypt a password for the configuration file", encryptCommand},
+	{"list", "list the Code Lists on B2Bi", listCommand},
+	{"versions", "show, activate, compare, export or purge the versions of a Code List", versionsCommand},
+	{"reconcile", "make the Code Lists on B2Bi match a directory of CSV or YAML files", reconcileCommand},
+	{"drift", "report the Code Lists changed on B2Bi outside this tool", driftCommand},
+	{"sync", "copy Code Lists between B2Bi, a directory and a SQLite database", syncCommand},
+	{"doctor", "check the configuration file and the connection to B2Bi", doctorCommand},
+}
+
+func updateCommand(args []string) {
+	flags := newFlagSet("update", "[-conf <config filename>] [-plan] [-strategy <strategy>] [-format <format>] -input <input document>",
+		"Updates the Code Lists on B2Bi, each sheet of the input document (except Instructions) is a Code List.\n"+
+			"CSV and TSV files hold one Code List named after the file, or a codeListName column, a directory holds\n"+
+			"CSV and TSV files, JSON and YAML documents hold Code Lists in the model of the REST API and XML files are\n"+
+			"resource manager exports.\n"+
+			"A backup of the Code Lists is created before they are updated and every step is recorded in a run journal,\n"+
+			"a run that stops before it finishes can be continued with resume or undone with rollback.\n\n"+
+			"Strategies:\n"+
+			"  replace      delete every version of the Code List, then load the codes of the input document\n"+
+			"  new-version  create a new active version, the earlier versions are kept for a rollback\n"+
+			"  merge        apply the rows of the input document as changes to the live Code List\n\n"+
+			"Actions (first column):\n"+
+			"  Yes          load the code, with merge the code is added or updated\n"+
+			"  Add, Update  add a code that must not exist, update a code that must exist\n"+
+			"  Delete       remove the code from the live Code List\n"+
+			"  Keep         keep the live code unchanged\n"+
+			"  No           ignore the row\n"+
+			"A sheet using Add, Update, Delete or Keep holds changes to the live Code List whatever the strategy,\n"+
+			"the other codes of the live Code List are kept.")
+	var conf, input, strategy, format string
+	var plan bool
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.StringVar(&input, "input", "", "input file name")
+	flags.StringVar(&format, "format", "", formatUsage)
+	flags.BoolVar(&plan, "plan", false, "show the changes without updating the code lists")
+	flags.StringVar(&strategy, "strategy", "", "update strategy: replace, new-version or merge (default the strategy key of the config file, or replace)")
+	flags.Parse(args)
+	if input == "" && flags.NArg() == 1 {
+		input = flags.Arg(0)
+	}
+	if input == "" {
+		errorsList = append(errorsList, "Missing input document")
+	}
+	validateInputs(conf, input)
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	manageBulkUpdate(conf, input, format, plan, strategy)
+}
+
+func exportCommand(args []string) {
+	flags := newFlagSet("export", "[-conf <config filename>] [-output <XLSX or XML document>] [-format <xlsx|xml>] [<code list name or pattern> ...]",
+		"Exports the active version of the named Code Lists, or of every Code List when none is given, into a workbook\n"+
+			"using the layout of the input document, or into a resource manager XML file that can be imported into B2Bi.\n"+
+			"Names may use the * and ? wildcards, e.g. AMF_XREF_*.")
+	var conf, output, format string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.StringVar(&output, "output", "", "output file name (default codelist_export_<timestamp>.xlsx)")
+	flags.StringVar(&format, "format", "", "output format: xlsx or xml (default by the output file extension, or xlsx)")
+	flags.Parse(args)
+	format = outputFormat(output, format)
+	if format != "xlsx" && format != "xml" {
+		errorsList = append(errorsList, "ERROR: invalid output format \""+format+"\" (xlsx or xml)")
+		showErrors("")
+		os.Exit(10001)
+	}
+	if output == "" {
+		output = "codelist_export_" + formattedCurTimeStamp("20060102_150405") + "." + format
+	}
+	service := newService(conf, true)
+	err := service.runExport(output, format, flags.Args())
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList export failed")
+		os.Exit(10003)
+	}
+}
+
+// outputFormat returns the format of an output document, given by -format
+// or by the extension of the output file.
+func outputFormat(output, format string) string {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+	}
+	if format == "" {
+		format = "xlsx"
+	}
+	return format
+}
+
+func convertCommand(args []string) {
+	flags := newFlagSet("convert", "[-conf <config filename>] [-format <format>] <input document> <XLSX or XML document>",
+		"Converts the Code Lists of an input document, e.g. a resource manager XML export, into a workbook using the\n"+
+			"layout of the input document or into a resource manager XML file, B2Bi is not contacted.")
+	var conf, format string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name, used for the columns and schemas when it exists")
+	flags.StringVar(&format, "format", "", formatUsage)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	if !fileExists(input) {
+		errorsList = append(errorsList, input+" not found")
+	}
+	if outputFormat(output, "") != "xlsx" && outputFormat(output, "") != "xml" {
+		errorsList = append(errorsList, "ERROR: the output document must be a .xlsx or .xml file")
+	}
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	service := newOfflineService(conf)
+	err := service.runConvert(input, format, output, outputFormat(output, ""))
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList conversion failed")
+		os.Exit(10003)
+	}
+}
+
+func restoreCommand(args []string) {
+	flags := newFlagSet("restore", "[-conf <config filename>] [-lists <name,...>] <backup XLSX document>",
+		"Recreates the Code Lists saved in a bkp_codelist_<timestamp>.xlsx backup file.\n"+
+			"All current versions of a restored Code List are deleted first, a new backup is taken before. The versions\n"+
+			"are recreated in version order and the version that was active is activated again.")
+	var conf, lists string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.StringVar(&lists, "lists", "", "comma separated Code List names or _ids to restore (default all)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	backup := flags.Arg(0)
+	validateInputs(conf, backup)
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	service := newService(conf, false)
+	err := service.runRestore(backup, splitList(lists))
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList restore failed")
+		os.Exit(10003)
+	}
+}
+
+func resumeCommand(args []string) {
+	flags := newFlagSet("resume", "[-conf <config filename>] <run id>",
+		"Continues an update run from its journal in the journaldir directory of the configuration file (default\n"+
+			"codelist-journal), the run id is printed when the update starts. The input document, format and strategy\n"+
+			"of the run are used again, the Code Lists already updated and verified are skipped and the versions\n"+
+			"already deleted are not deleted again. The input document must not have changed since the run started.")
+	var conf string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	validateInputs(conf, "")
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	service := newService(conf, false)
+	err := service.runResume(flags.Arg(0))
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList resume failed")
+		os.Exit(10003)
+	}
+}
+
+func rollbackCommand(args []string) {
+	flags := newFlagSet("rollback", "[-conf <config filename>] [-lists <name,...>] <run id>",
+		"Restores the Code Lists changed by an update run from the backup file taken by the run, the Code Lists\n"+
+			"created by the run are deleted. All current versions of a restored Code List are deleted first, a new\n"+
+			"backup is taken before. The rollback is recorded in the journal of the run.")
+	var conf, lists string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.StringVar(&lists, "lists", "", "comma separated Code List names or patterns to roll back (default all changed by the run)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	validateInputs(conf, "")
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	service := newService(conf, false)
+	err := service.runRollback(flags.Arg(0), splitList(lists))
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList rollback failed")
+		os.Exit(10003)
+	}
+}
+
+func diffCommand(args []string) {
+	flags := newFlagSet("diff", "[-conf <config filename>] [-strategy <strategy>] [-format <format>] [-lists <name,...>] [-report text|json|xlsx] [-output <file>] <source> [<source>]",
+		"With one input document, shows the codes that would be added, removed or changed by an update.\n"+
+			"With two sources, shows the codes added, removed or changed going from the first source to the second.\n"+
+			"A source is an input document, an export, a backup (backup.xlsx@N for the version N saved in it),\n"+
+			"live for the Code Lists on B2Bi or live@N for their version N. A sheet using Add, Update, Delete or Keep\n"+
+			"is applied to the codes of the other source. Nothing is changed on B2Bi.")
+	var conf, strategy, format, lists, report, output string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.StringVar(&strategy, "strategy", "", "update strategy: replace, new-version or merge (default the strategy key of the config file, or replace)")
+	flags.StringVar(&format, "format", "", formatUsage)
+	flags.StringVar(&lists, "lists", "", "comma separated Code List names to compare (default the Code Lists of the sources)")
+	flags.StringVar(&report, "report", "text", "report format of two sources: text, json or xlsx")
+	flags.StringVar(&output, "output", "", "report file name (default the standard output, codelist_diff_<timestamp>.xlsx for xlsx)")
+	flags.Parse(args)
+	if flags.NArg() == 1 {
+		validateInputs(conf, flags.Arg(0))
+		if len(errorsList) > 0 {
+			showErrors("")
+			os.Exit(10001)
+		}
+		manageBulkUpdate(conf, flags.Arg(0), format, true, strategy)
+		return
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	if report != "text" && report != "json" && report != "xlsx" {
+		errorsList = append(errorsList, "ERROR: invalid report format \""+report+"\" (text, json or xlsx)")
+	}
+	if report == "xlsx" && output == "" {
+		output = "codelist_diff_" + formattedCurTimeStamp("20060102_150405") + ".xlsx"
+	}
+	left, err := parseSource(flags.Arg(0))
+	if err != nil {
+		errorsList = append(errorsList, "ERROR: "+err.Error())
+	}
+	right, err := parseSource(flags.Arg(1))
+	if err != nil {
+		errorsList = append(errorsList, "ERROR: "+err.Error())
+	}
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	var service *apiMgr
+	if left.isLive() || right.isLive() {
+		service = newService(conf, true)
+	} else {
+		service = newOfflineService(conf)
+	}
+	err = service.runCompare(left, right, format, splitList(lists), report, output)
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList diff failed")
+		os.Exit(10003)
+	}
+}
+
+func validateCommand(args []string) {
+	flags := newFlagSet("validate", "[-conf <config filename>] [-format <format>] <input document>",
+		"Checks the rows of every Code List sheet in the input document, B2Bi is not contacted.\n"+
+			"Duplicate sender codes, invalid actions, field lengths and illegal characters are reported with their cell,\n"+
+			"the [rules] and [rules:<code list name>] sections of the configuration file add per Code List checks\n"+
+			"and the types of the [schema:<code list name>] section are enforced.")
+	var conf, format string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name, used for the validation rules when it exists")
+	flags.StringVar(&format, "format", "", formatUsage)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	input := flags.Arg(0)
+	if !fileExists(input) {
+		errorsList = append(errorsList, input+" not found")
+		showErrors("")
+		os.Exit(10001)
+	}
+	var config *ini.File
+	if fileExists(conf) {
+		config = loadConfig(conf)
+	} else if conf != "apimgr.conf" {
+		errorsList = append(errorsList, conf+" not found")
+		showErrors("")
+		os.Exit(10001)
+	}
+	err := runValidate(input, format, config)
+	if err != nil {
+		showErrors("ERROR: CodeList validation failed")
+		os.Exit(10004)
+	}
+}
+
+func encryptCommand(args []string) {
+	flags := newFlagSet("encrypt", "[-conf <config filename>]",
+		"Prompts twice for the password of the API user and stores its encrypted value as the password key\n"+
+			"of the DEFAULT section, a timestamped backup of the configuration file is kept.")
+	var conf string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.StringVar(&conf, "c", "apimgr.conf", "configuration file name (same as -conf)")
+	flags.Parse(args)
+	validateInputs(conf, "")
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	password := readPassword("Password: ")
+	if password == "" {
+		errorsList = append(errorsList, "ERROR: the password can not be empty")
+		showErrors("")
+		os.Exit(10001)
+	}
+	if readPassword("Confirm password: ") != password {
+		errorsList = append(errorsList, "ERROR: the passwords do not match")
+		showErrors("")
+		os.Exit(10001)
+	}
+	encrypted := encrypt(password)
+	if encrypted == "" {
+		errorsList = append(errorsList, "ERROR: unable to encrypt the password")
+		showErrors("")
+		os.Exit(10003)
+	}
+	bkpfile, err := updatePassword(conf, encrypted)
+	if err != nil {
+		errorsList = append(errorsList, "ERROR: unable to update "+conf+" "+err.Error())
+		showErrors("")
+		os.Exit(10003)
+	}
+	fmt.Println("A backup file \"" + bkpfile + "\" has been created.")
+	fmt.Println("The password in \"" + conf + "\" has been updated.")
+}
+
+// readPassword prompts for a password without echoing it, when the standard
+// input is not a terminal the password is read as a line.
+func readPassword(prompt string) string {
+	fmt.Print(prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return ""
+		}
+		return string(password)
+	}
+	text, _ := stdin.ReadString('\n')
+	fmt.Println()
+	return strings.TrimRight(text, "\r\n")
+}
+
+func listCommand(args []string) {
+	flags := newFlagSet("list", "[-conf <config filename>] [-versions]",
+		"Lists the Code Lists on B2Bi with their version, status, creation date and user.")
+	var conf string
+	var versions bool
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.BoolVar(&versions, "versions", false, "list every version instead of the active ones")
+	flags.Parse(args)
+	service := newService(conf, true)
+	err := service.runList(versions)
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList list failed")
+		os.Exit(10003)
+	}
+}
+
+func syncCommand(args []string) {
+	flags := newFlagSet("sync", "[-conf <config filename>] [-dry-run] [<code list name or pattern> ...] <from store> <to store>",
+		"Copies the active version of the Code Lists from one store to another, a new active version is created in\n"+
+			"the target store when the codes differ. A store is live for B2Bi, dir:<directory> for a directory of JSON\n"+
+			"files or sqlite:<database file> for a SQLite database. Names may use the * and ? wildcards.")
+	var conf string
+	var dryRun bool
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name, used when a store is live")
+	flags.BoolVar(&dryRun, "dry-run", false, "show the Code Lists that would be copied without copying them")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	specs := flags.Args()[flags.NArg()-2:]
+	stores := make([]store.CodeListStore, 0, 2)
+	for _, spec := range specs {
+		opened, err := openStore(spec, conf)
+		if err != nil {
+			errorsList = append(errorsList, "ERROR: "+err.Error())
+			continue
+		}
+		stores = append(stores, opened)
+	}
+	if len(errorsList) > 0 {
+		closeStores(stores)
+		showErrors("")
+		os.Exit(10001)
+	}
+	fmt.Printf("Copying the Code Lists from %s to %s\n", specs[0], specs[1])
+	errorsList = runSync(stores[0], stores[1], flags.Args()[:flags.NArg()-2], dryRun)
+	errorsList = append(errorsList, closeStores(stores)...)
+	if len(errorsList) > 0 {
+		showErrors("ERROR: CodeList sync failed")
+		os.Exit(10003)
+	}
+}
+
+func versionsCommand(args []string) {
+	flags := newFlagSet("versions", "[-conf <config filename>] [-activate <N> | -compare <N,M> | -export <N> [-output <file>] | -purge <keep> [-dry-run]] <code list name> ...",
+		"Shows the versions of a Code List with their status, creation date, user and number of codes.\n"+
+			"-activate makes version N the active version, -compare shows the codes added, removed or changed going\n"+
+			"from version N to version M and -export writes version N into a workbook or a resource manager XML file.\n"+
+			"-purge deletes all but the <keep> most recent versions of the named Code Lists, the active version is always\n"+
+			"kept and the deleted versions are saved in a backup file. Names may use the * and ? wildcards with -purge.")
+	var conf, compare, output, format string
+	var activate, export, keep int
+	var dryRun bool
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.IntVar(&activate, "activate", 0, "version to activate")
+	flags.StringVar(&compare, "compare", "", "two versions to compare, e.g. 3,5")
+	flags.IntVar(&export, "export", 0, "version to export")
+	flags.StringVar(&output, "output", "", "output file name of -export (default codelist_export_<timestamp>.xlsx)")
+	flags.StringVar(&format, "format", "", "output format of -export: xlsx or xml (default by the output file extension, or xlsx)")
+	flags.IntVar(&keep, "purge", 0, "number of most recent versions to keep")
+	flags.BoolVar(&dryRun, "dry-run", false, "show the versions -purge would delete without deleting them")
+	flags.Parse(args)
+	operations := 0
+	for _, set := range []bool{activate != 0, compare != "", export != 0, keep != 0} {
+		if set {
+			operations++
+		}
+	}
+	if operations > 1 || flags.NArg() == 0 || (keep == 0 && flags.NArg() != 1) {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	var from, to int
+	if compare != "" {
+		if n, err := fmt.Sscanf(compare, "%d,%d", &from, &to); err != nil || n != 2 {
+			errorsList = append(errorsList, "ERROR: invalid -compare \""+compare+"\", e.g. 3,5")
+		}
+	}
+	if keep < 0 || activate < 0 || export < 0 {
+		errorsList = append(errorsList, "ERROR: versions must be positive numbers")
+	}
+	format = outputFormat(output, format)
+	if export != 0 && format != "xlsx" && format != "xml" {
+		errorsList = append(errorsList, "ERROR: invalid output format \""+format+"\" (xlsx or xml)")
+	}
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	if output == "" {
+		output = "codelist_export_" + formattedCurTimeStamp("20060102_150405") + "." + format
+	}
+	service := newService(conf, keep == 0 || dryRun)
+	name := flags.Arg(0)
+	var err error
+	switch {
+	case activate != 0:
+		err = service.activateVersion(name, activate)
+	case compare != "":
+		err = service.compareVersions(name, from, to)
+	case export != 0:
+		err = service.exportListVersion(name, export, output, format)
+	case keep != 0:
+		err = service.purgeVersions(flags.Args(), keep, dryRun)
+	default:
+		err = service.runVersions(name)
+	}
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList versions failed")
+		os.Exit(10003)
+	}
+}
+
+func reconcileCommand(args []string) {
+	flags := newFlagSet("reconcile", "[-conf <config filename>] [-plan] [-pull] [-file-format csv|yaml] <directory> [<code list name or pattern> ...]",
+		"Treats a directory with one CSV or YAML file per Code List as the desired state of the Code Lists on B2Bi.\n"+
+			"A CSV file is named after its Code List (escaped as in a URL) and holds SenderCode, ReceiverCode, Description\n"+
+			"and Text1 to Text9 columns, a YAML file holds the codeListName and the codes in the model of the REST API.\n"+
+			"Only the Code Lists whose codes differ are backed up and updated, missing Code Lists are created and the\n"+
+			"Code Lists on B2Bi without a file are left unchanged. With -pull, the active version of the Code Lists on\n"+
+			"B2Bi is written into the directory instead, the codes in sender code order.\n"+
+			"Names may use the * and ? wildcards.")
+	var conf, fileFormat string
+	var plan, pull bool
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.BoolVar(&plan, "plan", false, "show the changes without updating the code lists")
+	flags.BoolVar(&pull, "pull", false, "write the Code Lists on B2Bi into the directory")
+	flags.StringVar(&fileFormat, "file-format", "csv", "file format written by -pull: csv or yaml")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(10001)
+	}
+	dir := flags.Arg(0)
+	if fileFormat != "csv" && fileFormat != "yaml" {
+		errorsList = append(errorsList, "ERROR: invalid file format \""+fileFormat+"\" (csv or yaml)")
+	}
+	if info, err := os.Stat(dir); !pull && (err != nil || !info.IsDir()) {
+		errorsList = append(errorsList, dir+" not found")
+	}
+	validateInputs(conf, "")
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
+	service := newService(conf, plan || pull)
+	var err error
+	if pull {
+		err = service.runPull(dir, fileFormat, flags.Args()[1:])
+	} else {
+		err = service.runReconcile(dir, flags.Args()[1:], plan)
+	}
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList reconcile failed")
+		os.Exit(10003)
+	}
+}
+
+func driftCommand(args []string) {
+	flags := newFlagSet("drift", "[-conf <config filename>] [-accept] [<code list name or pattern> ...]",
+		"Compares the Code Lists on B2Bi, with the user and date of their versions, against the state last applied\n"+
+			"by this tool and reports the Code Lists changed, created or deleted by someone else. The applied state is\n"+
+			"recorded after every update in the statedir directory of the configuration file (default codelist-state).\n"+
+			"Exits with 10006 when a drift is found, for use in a scheduled check. Names may use the * and ? wildcards.")
+	var conf string
+	var accept bool
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.BoolVar(&accept, "accept", false, "record the live state of the Code Lists as the applied state")
+	flags.Parse(args)
+	service := newService(conf, true)
+	drifted, err := service.runDrift(flags.Args(), accept)
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: CodeList drift check failed")
+		os.Exit(10003)
+	}
+	if drifted > 0 {
+		os.Exit(10006)
+	}
+}
+
+func doctorCommand(args []string) {
+	flags := newFlagSet("doctor", "[-conf <config filename>]",
+		"Checks the configuration file, the password, the connection to B2Bi and the backup directory.")
+	var conf string
+	flags.StringVar(&conf, "conf", "apimgr.conf", "configuration file name")
+	flags.Parse(args)
+	if !runDoctor(conf) {
+		os.Exit(10005)
+	}
+}
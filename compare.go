@@ -0,0 +1,446 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"encoding/json"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// liveSource is the name of the live B2Bi source of a comparison, live@N
+// is the version N of the code lists on B2Bi.
+const liveSource = "live"
+
+// codeSource is one side of a comparison: an input document, an export, a
+// backup (file@N for the version N saved in it) or the live code lists.
+type codeSource struct {
+	spec    string
+	path    string
+	version int
+}
+
+// parseSource reads the specification of a source, e.g. live, live@3,
+// bkp_codelist_20220301_101010.xlsx@2 or input.csv.
+func parseSource(spec string) (codeSource, error) {
+	source := codeSource{spec: spec, path: spec}
+	if pos := strings.LastIndex(spec, "@"); pos > 0 && !fileExists(spec) {
+		version, err := strconv.Atoi(spec[pos+1:])
+		if err != nil || version <= 0 {
+			return source, fmt.Errorf("invalid version in \"%s\"", spec)
+		}
+		source.path, source.version = spec[:pos], version
+	}
+	if source.path == liveSource {
+		source.path = ""
+	} else if !fileExists(source.path) {
+		return source, fmt.Errorf("%s not found", source.path)
+	}
+	return source, nil
+}
+
+func (source codeSource) isLive() bool {
+	return source.path == ""
+}
+
+// sourceCodes are the codes of the code lists of a source by name.
+type sourceCodes struct {
+	names []string
+	codes map[string][]codelistItem
+}
+
+func (codes *sourceCodes) add(name string, items []codelistItem) {
+	if _, ok := codes.codes[name]; !ok {
+		codes.names = append(codes.names, name)
+	}
+	codes.codes[name] = items
+}
+
+// readSource returns the codes of a source, the live code lists are read for
+// the given names only.
+func (mgr *apiMgr) readSource(source codeSource, format string, names []string) (*sourceCodes, error) {
+	result := &sourceCodes{codes: make(map[string][]codelistItem)}
+	if source.isLive() {
+		for _, name := range names {
+			mgr.codelist = name
+			versions, err := mgr.fetchCodelists()
+			if err != nil {
+				return nil, fmt.Errorf("unable to read Code List \"%s\" %s", name, err.Error())
+			}
+			codelist, err := selectVersion(name, versions, source.version)
+			if err != nil && err != store.ErrNotFound {
+				return nil, err
+			}
+			if err == nil {
+				items := make([]codelistItem, 0, len(codelist.Codes))
+				for _, code := range codelist.Codes {
+					items = append(items, itemFromCode(code))
+				}
+				result.add(name, items)
+			}
+		}
+		return result, nil
+	}
+
+	lists, err := readInput(source.path, format)
+	if err != nil {
+		return nil, err
+	}
+	// the sheets of a backup file are mapped to the _id and list status in
+	// its Versions sheet
+	saved := make(map[string]backupSheet)
+	for _, list := range lists {
+		if list.name == backupVersionsSheet && len(list.rows) > 0 {
+			sheets, _ := backupSheets(list.rows[1:])
+			for _, sheet := range sheets {
+				saved[sheet.sheet] = sheet
+			}
+		}
+	}
+	sheets := make([]backupSheet, len(lists))
+	versions := make(map[string][]b2bapi.CodeList)
+	for i, list := range lists {
+		sheet, ok := saved[list.name]
+		if !ok {
+			name, version, err := parseCodelistID(list.name)
+			if err != nil {
+				name, version = list.name, 0
+			}
+			sheet = backupSheet{sheet: list.name, id: list.name, name: name, version: version}
+		}
+		sheets[i] = sheet
+		if list.name == backupVersionsSheet && len(saved) > 0 {
+			continue
+		}
+		versions[sheet.name] = append(versions[sheet.name], b2bapi.CodeList{ID: sheet.id, CodeListName: sheet.name, VersionNumber: sheet.version, ListStatus: sheet.status})
+	}
+	// the version compared is selected as on the live source, the version
+	// active in the Versions sheet or the highest one
+	selected := make(map[string]string)
+	for name, listVersions := range versions {
+		codelist, err := selectVersion(name, listVersions, source.version)
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+		if err == nil {
+			selected[name] = codelist.ID
+		}
+	}
+	for i, list := range lists {
+		sheet := sheets[i]
+		if (list.name == backupVersionsSheet && len(saved) > 0) || selected[sheet.name] != sheet.id {
+			continue
+		}
+		items, codelistErrors := readCodelistRows(sheet.id, list.rows, mgr.listColumns(sheet.name), list.workbook)
+		for _, errormsg := range codelistErrors {
+			mgr.addError(source.spec + " " + sheet.id + ": " + errormsg)
+		}
+		result.add(sheet.name, items)
+	}
+	return result, nil
+}
+
+// selectVersion returns the given version of a code list, or the version
+// used by export when version is 0.
+func selectVersion(name string, versions []b2bapi.CodeList, version int) (*b2bapi.CodeList, error) {
+	if version == 0 {
+		return store.ResolveVersion(name, versions)
+	}
+	return store.SelectVersion(versions, version)
+}
+
+// comparison is the difference of a code list between two sources, the
+// codes are added or removed going from the left to the right source.
+type comparison struct {
+	name    string
+	inLeft  bool
+	inRight bool
+	plan    *codelistPlan
+}
+
+// runCompare compares the code lists of two sources and writes the
+// differences as text, json or xlsx.
+func (mgr *apiMgr) runCompare(left, right codeSource, format string, selection []string, report, output string) error {
+	sources := []codeSource{left, right}
+	sides := make([]*sourceCodes, len(sources))
+	names := selection
+	for i, source := range sources {
+		if source.isLive() {
+			continue
+		}
+		codes, err := mgr.readSource(source, format, nil)
+		if err != nil {
+			mgr.addError("ERROR - Invalid input file [" + source.path + "] " + err.Error())
+			return err
+		}
+		sides[i] = codes
+		if len(selection) > 0 {
+			continue
+		}
+		for _, name := range codes.names {
+			if !containsName(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 && left.isLive() && right.isLive() {
+		codelists, err := mgr.listCodelists()
+		if err != nil {
+			mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+			return err
+		}
+		for _, codelist := range codelists {
+			if !containsName(names, codelist.CodeListName) {
+				names = append(names, codelist.CodeListName)
+			}
+		}
+		sort.Strings(names)
+	}
+	for i, source := range sources {
+		if !source.isLive() {
+			continue
+		}
+		codes, err := mgr.readSource(source, format, names)
+		if err != nil {
+			mgr.addError("ERROR: unable to read " + source.spec + " " + err.Error())
+			return err
+		}
+		sides[i] = codes
+	}
+	comparisons := make([]comparison, 0, len(names))
+	for _, name := range names {
+		leftCodes, inLeft := sides[0].codes[name]
+		rightCodes, inRight := sides[1].codes[name]
+		// a delta sheet holds changes to the codes of the other source
+		var deltaErrors []string
+		switch {
+		case isDelta(leftCodes) && isDelta(rightCodes):
+			mgr.addError("ERROR: Code List \"" + name + "\" holds changes in both sources, not compared")
+			continue
+		case isDelta(leftCodes):
+			leftCodes, deltaErrors = mergeCodes(rightCodes, leftCodes)
+		case isDelta(rightCodes):
+			rightCodes, deltaErrors = mergeCodes(leftCodes, rightCodes)
+		}
+		for _, errormsg := range deltaErrors {
+			mgr.addError(name + ": " + errormsg)
+		}
+		comparisons = append(comparisons, comparison{name: name, inLeft: inLeft, inRight: inRight, plan: diffCodes(name, leftCodes, rightCodes)})
+	}
+
+	var err error
+	switch report {
+	case "json":
+		err = writeCompareJSON(output, left, right, comparisons)
+	case "xlsx":
+		err = writeCompareWorkbook(output, left, right, comparisons)
+		if err == nil {
+			fmt.Println("The differences have been written to \"" + output + "\".")
+		}
+	default:
+		printComparisons(left, right, comparisons)
+	}
+	if err != nil {
+		mgr.addError("ERROR: unable to write the differences " + err.Error())
+		return err
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Compare failed")
+	}
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func printComparisons(left, right codeSource, comparisons []comparison) {
+	fmt.Printf("Comparing \"%s\" with \"%s\"\n", left.spec, right.spec)
+	different := 0
+	for _, compared := range comparisons {
+		plan := compared.plan
+		switch {
+		case !compared.inLeft && !compared.inRight:
+			fmt.Printf("Code List \"%s\": not found\n", compared.name)
+			continue
+		case !compared.inLeft:
+			fmt.Printf("Code List \"%s\": only in %s\n", compared.name, right.spec)
+		case !compared.inRight:
+			fmt.Printf("Code List \"%s\": only in %s\n", compared.name, left.spec)
+		default:
+			fmt.Printf("Code List \"%s\":\n", compared.name)
+		}
+		for _, item := range plan.added {
+			fmt.Printf("  + %s -> %s\n", item.senderCode, item.receiverCode)
+		}
+		for _, item := range plan.removed {
+			fmt.Printf("  - %s -> %s\n", item.senderCode, item.receiverCode)
+		}
+		for _, change := range plan.changed {
+			fmt.Printf("  ~ %s\n", change)
+		}
+		fmt.Printf("  %d added, %d removed, %d changed, %d unchanged\n", len(plan.added), len(plan.removed), len(plan.changed), plan.unchanged)
+		if plan.hasChanges() || compared.inLeft != compared.inRight {
+			different++
+		}
+	}
+	fmt.Printf("%d Code List(s) compared, %d with differences.\n", len(comparisons), different)
+}
+
+type jsonFieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type jsonCodeChange struct {
+	SenderCode string            `json:"senderCode"`
+	Fields     []jsonFieldChange `json:"fields"`
+}
+
+type jsonComparison struct {
+	CodeListName string           `json:"codeListName"`
+	InLeft       bool             `json:"inLeft"`
+	InRight      bool             `json:"inRight"`
+	Added        []b2bapi.Code    `json:"added"`
+	Removed      []b2bapi.Code    `json:"removed"`
+	Changed      []jsonCodeChange `json:"changed"`
+	Unchanged    int              `json:"unchanged"`
+}
+
+type jsonReport struct {
+	Left      string           `json:"left"`
+	Right     string           `json:"right"`
+	CodeLists []jsonComparison `json:"codeLists"`
+}
+
+// writeCompareJSON writes the differences to output, or to the standard
+// output when it is empty.
+func writeCompareJSON(output string, left, right codeSource, comparisons []comparison) error {
+	report := jsonReport{Left: left.spec, Right: right.spec, CodeLists: make([]jsonComparison, 0, len(comparisons))}
+	for _, compared := range comparisons {
+		plan := compared.plan
+		converted := jsonComparison{
+			CodeListName: compared.name,
+			InLeft:       compared.inLeft,
+			InRight:      compared.inRight,
+			Added:        apiCodes(plan.added),
+			Removed:      apiCodes(plan.removed),
+			Changed:      make([]jsonCodeChange, 0, len(plan.changed)),
+			Unchanged:    plan.unchanged,
+		}
+		for _, change := range plan.changed {
+			codeChange := jsonCodeChange{SenderCode: change.senderCode}
+			for _, field := range change.fields {
+				codeChange.Fields = append(codeChange.Fields, jsonFieldChange{Field: field.field, Old: field.old, New: field.new})
+			}
+			converted.Changed = append(converted.Changed, codeChange)
+		}
+		report.CodeLists = append(report.CodeLists, converted)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
+
+// writeCompareWorkbook writes a summary sheet and a sheet per code list with
+// differences, added codes are green, removed codes red and the changed
+// cells yellow with the previous value as a comment.
+func writeCompareWorkbook(output string, left, right codeSource, comparisons []comparison) error {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Summary")
+	added, _ := f.NewStyle(`{"fill":{"type":"pattern","color":["#C6EFCE"],"pattern":1}}`)
+	removed, _ := f.NewStyle(`{"fill":{"type":"pattern","color":["#FFC7CE"],"pattern":1}}`)
+	changed, _ := f.NewStyle(`{"fill":{"type":"pattern","color":["#FFEB9C"],"pattern":1}}`)
+
+	summary := []string{"CodeListName", "Added", "Removed", "Changed", "Unchanged", "Note"}
+	for col, title := range summary {
+		f.SetCellValue("Summary", excelize.ToAlphaString(col)+"1", title)
+	}
+	f.SetCellValue("Summary", "H1", "Left: "+left.spec)
+	f.SetCellValue("Summary", "H2", "Right: "+right.spec)
+	header := listSchema(nil).header("Change")
+	for i, compared := range comparisons {
+		plan := compared.plan
+		row := strconv.Itoa(i + 2)
+		note := ""
+		switch {
+		case !compared.inLeft && !compared.inRight:
+			note = "not found"
+		case !compared.inLeft:
+			note = "only in " + right.spec
+		case !compared.inRight:
+			note = "only in " + left.spec
+		}
+		values := []interface{}{compared.name, len(plan.added), len(plan.removed), len(plan.changed), plan.unchanged}
+		for col, value := range values {
+			f.SetCellValue("Summary", excelize.ToAlphaString(col)+row, value)
+		}
+		if !plan.hasChanges() {
+			f.SetCellValue("Summary", "F"+row, note)
+			continue
+		}
+		if !isSheetName(compared.name) {
+			f.SetCellValue("Summary", "F"+row, strings.TrimSpace(note+" (no sheet, the name can not be used as a sheet name)"))
+			continue
+		}
+		f.SetCellValue("Summary", "F"+row, note)
+
+		sheet := compared.name
+		f.NewSheet(sheet)
+		for col, title := range header {
+			f.SetCellValue(sheet, excelize.ToAlphaString(col)+"1", title)
+		}
+		rownum := 2
+		writeRow := func(change string, item codelistItem) string {
+			cells := append([]string{change, item.senderCode}, item.values()...)
+			for col, value := range cells {
+				f.SetCellValue(sheet, excelize.ToAlphaString(col)+strconv.Itoa(rownum), value)
+			}
+			rownum++
+			return strconv.Itoa(rownum - 1)
+		}
+		last := excelize.ToAlphaString(len(header) - 1)
+		for _, item := range plan.added {
+			r := writeRow("Added", item)
+			f.SetCellStyle(sheet, "A"+r, last+r, added)
+		}
+		for _, item := range plan.removed {
+			r := writeRow("Removed", item)
+			f.SetCellStyle(sheet, "A"+r, last+r, removed)
+		}
+		for _, change := range plan.changed {
+			r := writeRow("Changed", change.item)
+			for _, field := range change.fields {
+				col := 2
+				for i, name := range codeFieldNames {
+					if name == field.field {
+						col = i + 2
+					}
+				}
+				cell := excelize.ToAlphaString(col) + r
+				f.SetCellStyle(sheet, cell, cell, changed)
+				text, _ := json.Marshal("was: " + field.old)
+				f.AddComment(sheet, cell, `{"author":"codelistmgr","text":`+string(text)+`}`)
+			}
+		}
+	}
+	return f.SaveAs(output)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestReadSourceVersion(t *testing.T) {
+	columns, _ := loadColumnAliases(nil)
+	tests := []struct {
+		name    string
+		status  []int
+		version int
+		want    string
+	}{
+		{"active version", []int{1, 0, 0}, 0, "A"},
+		{"no active version", []int{0, 0, 0}, 0, "C"},
+		{"given version", []int{1, 0, 0}, 2, "B"},
+	}
+	for _, test := range tests {
+		mgr := &apiMgr{columns: columns, bkpfileptr: excelize.NewFile()}
+		for i, sender := range []string{"A", "B", "C"} {
+			version := i + 1
+			mgr.WriteCodeListItem(b2bapi.CodeList{ID: "LIST|||" + strconv.Itoa(version), CodeListName: "LIST", VersionNumber: version, ListStatus: test.status[i], Codes: []b2bapi.Code{{SenderCode: sender, ReceiverCode: "R" + sender}}})
+		}
+		path := filepath.Join(t.TempDir(), "bkp.xlsx")
+		if err := mgr.bkpfileptr.SaveAs(path); err != nil {
+			t.Fatal(err)
+		}
+		codes, err := mgr.readSource(codeSource{spec: path, path: path, version: test.version}, "", nil)
+		if err != nil {
+			t.Fatalf("%s: readSource: %v", test.name, err)
+		}
+		items := codes.codes["LIST"]
+		if len(items) != 1 || items[0].senderCode != test.want {
+			t.Errorf("%s: codes %v, want %s", test.name, items, test.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"crypto/tls"
+	"fmt"
+	"gopkg.in/ini.v1"
+	"time"
+)
+
+// loadClientOptions returns the connection settings of the DEFAULT and [tls]
+// sections of the configuration file, durations are written as 30s or 2m:
+//
+//	connecttimeout = 10s
+//	readtimeout = 2m
+//	retries = 3
+//	retrywait = 1s
+//	pagesize = 1000
+func loadClientOptions(config *ini.File) (b2bapi.Options, []string) {
+	sec := config.Section("DEFAULT")
+	optionErrors := make([]string, 0)
+	opts := b2bapi.Options{
+		Logf: func(format string, args ...interface{}) {
+			fmt.Printf("WARNING: "+format+"\n", args...)
+		},
+	}
+	durations := []struct {
+		key   string
+		value *time.Duration
+		def   time.Duration
+	}{
+		{"connecttimeout", &opts.ConnectTimeout, 10 * time.Second},
+		{"readtimeout", &opts.ReadTimeout, 2 * time.Minute},
+		{"retrywait", &opts.RetryWait, time.Second},
+	}
+	for _, duration := range durations {
+		*duration.value = duration.def
+		if sec.Key(duration.key).String() == "" {
+			continue
+		}
+		value, err := sec.Key(duration.key).Duration()
+		if err != nil || value < 0 {
+			optionErrors = append(optionErrors, "ERROR: invalid "+duration.key+" \""+sec.Key(duration.key).String()+"\", e.g. 30s or 2m")
+			continue
+		}
+		*duration.value = value
+	}
+	counts := []struct {
+		key   string
+		value *int
+		def   int
+		min   int
+	}{
+		{"retries", &opts.Retries, 3, 0},
+		{"pagesize", &opts.PageSize, 1000, 1},
+	}
+	for _, count := range counts {
+		*count.value = count.def
+		if sec.Key(count.key).String() == "" {
+			continue
+		}
+		value, err := sec.Key(count.key).Int()
+		if err != nil || value < count.min {
+			optionErrors = append(optionErrors, "ERROR: invalid "+count.key+" \""+sec.Key(count.key).String()+"\"")
+			continue
+		}
+		*count.value = value
+	}
+	tlsConfig, err := loadTLSConfig(config)
+	if err != nil {
+		optionErrors = append(optionErrors, "ERROR: "+err.Error())
+	}
+	opts.TLSConfig = tlsConfig
+	return opts, optionErrors
+}
+
+// loadTLSConfig returns the TLS configuration of the [tls] section of the
+// configuration file, the server certificate is verified unless insecure
+// is set:
+//
+//	[tls]
+//	cafile = /etc/pki/b2bi-ca.pem
+//	fingerprints = 3F:1A:..., 77:0B:...
+//	certfile = client.pem
+//	keyfile = client.key
+//	minversion = 1.2
+//	insecure = false
+func loadTLSConfig(config *ini.File) (*tls.Config, error) {
+	sec := config.Section("tls")
+	opts := b2bapi.TLSOptions{
+		CAFile:       sec.Key("cafile").String(),
+		Fingerprints: splitList(sec.Key("fingerprints").String()),
+		CertFile:     sec.Key("certfile").String(),
+		KeyFile:      sec.Key("keyfile").String(),
+		MinVersion:   sec.Key("minversion").String(),
+	}
+	insecure, err := sec.Key("insecure").Bool()
+	if err != nil && sec.Key("insecure").String() != "" {
+		return nil, fmt.Errorf("[tls] insecure must be true or false")
+	}
+	opts.Insecure = insecure
+	tlsConfig, err := opts.Config()
+	if err != nil {
+		return nil, fmt.Errorf("[tls] %s", err.Error())
+	}
+	if opts.Insecure {
+		fmt.Println("**********************************************************************")
+		fmt.Println("WARNING: insecure = true in the [tls] section of the configuration file.")
+		fmt.Println("WARNING: the certificate of B2Bi is NOT verified, the API password can be")
+		fmt.Println("WARNING: intercepted. Set cafile or fingerprints and remove insecure.")
+		if len(opts.Fingerprints) > 0 {
+			fmt.Println("WARNING: the pinned fingerprints are still checked.")
+		}
+		fmt.Println("**********************************************************************")
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"fmt"
+)
+
+// runConvert writes the code lists of an input document into a workbook or
+// a resource manager XML file. Rows with the Delete action are left out, the
+// Keep action needs the live code list and can not be converted.
+func (mgr *apiMgr) runConvert(input, format, output, outputFormat string) error {
+	lists, err := readInput(input, format)
+	if err != nil {
+		mgr.addError("ERROR - Invalid input file [" + input + "] " + err.Error())
+		return err
+	}
+	codelists := make([]b2bapi.CodeList, 0, len(lists))
+	for _, list := range lists {
+		items, codelistErrors := readCodelistRows(list.name, list.rows, mgr.listColumns(list.name), list.workbook)
+		items, loadErrors := loadedItems(nil, items)
+		for _, errormsg := range append(codelistErrors, loadErrors...) {
+			mgr.addError(list.name + ": " + errormsg)
+		}
+		if outputFormat == "xlsx" && !isSheetName(list.name) {
+			mgr.addError("ERROR: Code List \"" + list.name + "\" can not be used as a sheet name, not converted")
+			continue
+		}
+		codelists = append(codelists, b2bapi.CodeList{CodeListName: list.name, VersionNumber: 1, ListStatus: 1, Codes: apiCodes(items)})
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Conversion failed")
+	}
+	if outputFormat == "xml" {
+		err = writeResourceXML(output, codelists)
+	} else {
+		err = mgr.writeExportWorkbook(output, codelists)
+	}
+	if err != nil {
+		mgr.addError("ERROR: unable to write " + output)
+		return err
+	}
+	fmt.Printf("%d Code List(s) converted to \"%s\".\n", len(codelists), output)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"fmt"
+	"gopkg.in/ini.v1"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func doctorCheck(ok bool, check string, detail string) bool {
+	status := "OK"
+	if !ok {
+		status = "FAIL"
+	}
+	doctorReport(status, check, detail)
+	return ok
+}
+
+// doctorWarn reports a check that passed with a setting worth a look.
+func doctorWarn(check string, detail string) {
+	doctorReport("WARN", check, detail)
+}
+
+func doctorReport(status string, check string, detail string) {
+	if detail != "" {
+		check = check + " (" + detail + ")"
+	}
+	fmt.Printf("[%-4s] %s\n", status, check)
+}
+
+// runDoctor checks the configuration file, the password, the connection to
+// B2Bi and the backup directory. It returns false when a check failed.
+func runDoctor(conf string) bool {
+	fmt.Println("AMF CodeList Manager")
+	fmt.Println("======================================================================")
+	config, err := ini.Load(conf)
+	if !doctorCheck(err == nil, "configuration file "+conf, "") {
+		return false
+	}
+	sec, err := config.GetSection("DEFAULT")
+	if !doctorCheck(err == nil, "DEFAULT section", "") {
+		return false
+	}
+	healthy := true
+	for _, key := range []string{"username", "password", "apiurl"} {
+		healthy = doctorCheck(sec.Key(key).String() != "", "key "+key, "") && healthy
+	}
+	detail := ""
+	decrypted := decrypt(sec.Key("password").String()) != ""
+	if !decrypted {
+		detail = "run the encrypt command to update it"
+	}
+	healthy = doctorCheck(decrypted, "password decryption", detail) && healthy
+
+	mgr := &apiMgr{}
+	mgr.username = sec.Key("username").String()
+	mgr.password = decrypt(sec.Key("password").String())
+	mgr.apiurl = sec.Key("apiurl").String()
+	detail = ""
+	clientOptions, optionErrors := loadClientOptions(config)
+	if len(optionErrors) > 0 {
+		doctorCheck(false, "connection settings", strings.Join(optionErrors, ", "))
+		return false
+	}
+	// insecure only skips the chain verification, with fingerprints the
+	// certificate of B2Bi is still checked against the pinned ones
+	if !clientOptions.TLSConfig.InsecureSkipVerify {
+		doctorCheck(true, "connection settings", "")
+	} else if clientOptions.TLSConfig.VerifyPeerCertificate != nil {
+		doctorWarn("connection settings", "insecure, the certificate chain of B2Bi is not verified but its fingerprint is pinned")
+	} else {
+		healthy = doctorCheck(false, "connection settings", "insecure without fingerprints, the certificate of B2Bi is not verified") && healthy
+	}
+	mgr.client = b2bapi.NewClient(mgr.apiurl, mgr.username, mgr.password, clientOptions)
+	detail = ""
+	err = mgr.validateApiUrl()
+	if err != nil {
+		detail = err.Error()
+	}
+	healthy = doctorCheck(err == nil, "connection to "+mgr.apiurl, detail) && healthy
+
+	bkpdir := sec.Key("backupdir").String()
+	if bkpdir == "" {
+		bkpdir = "codelist-backup"
+	}
+	detail = ""
+	_, err = os.Stat(bkpdir)
+	if os.IsNotExist(err) {
+		detail = "will be created"
+		err = nil
+	} else if err == nil {
+		var tmpfile *os.File
+		tmpfile, err = ioutil.TempFile(bkpdir, "doctor")
+		if err == nil {
+			tmpfile.Close()
+			os.Remove(tmpfile.Name())
+		}
+	}
+	if err != nil {
+		detail = err.Error()
+	}
+	healthy = doctorCheck(err == nil, "backup directory "+bkpdir, detail) && healthy
+	return healthy
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// appliedState is the state of a code list on B2Bi right after this tool
+// changed it, it is kept as <statedir>/<code list name>.json.
+type appliedState struct {
+	AppliedAt b2bapi.Timestamp `json:"appliedAt"`
+	AppliedBy string           `json:"appliedBy"`
+	Versions  []string         `json:"versions"`
+	CodeList  b2bapi.CodeList  `json:"codeList"`
+}
+
+func (mgr *apiMgr) stateFile(name string) string {
+	return filepath.Join(mgr.statedir, url.PathEscape(name)+".json")
+}
+
+// recordApplied saves the live state of the current code list as the state
+// applied by this tool, a failure only prints a warning.
+func (mgr *apiMgr) recordApplied() {
+	versions, err := mgr.fetchCodelists()
+	if err == nil {
+		err = mgr.saveState(mgr.codelist, versions)
+	}
+	if err != nil {
+		fmt.Println("WARNING: unable to record the applied state of Code List \"" + mgr.codelist + "\" " + err.Error())
+	}
+}
+
+// saveState writes the state of a code list from its live versions, the
+// state file is removed when the code list has no version.
+func (mgr *apiMgr) saveState(name string, versions []b2bapi.CodeList) error {
+	codelist, err := store.ResolveVersion(name, versions)
+	if err == store.ErrNotFound {
+		err = os.Remove(mgr.stateFile(name))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	state := appliedState{
+		AppliedAt: b2bapi.Timestamp{Time: time.Now()},
+		AppliedBy: mgr.username,
+		Versions:  versionIDs(versions),
+		CodeList:  *codelist,
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(mgr.statedir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(mgr.stateFile(name), data, 0644)
+}
+
+// loadStates reads the applied states of the state directory by code list
+// name.
+func (mgr *apiMgr) loadStates() (map[string]appliedState, error) {
+	states := make(map[string]appliedState)
+	entries, err := ioutil.ReadDir(mgr.statedir)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(mgr.statedir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var state appliedState
+		err = json.Unmarshal(data, &state)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", entry.Name(), err.Error())
+		}
+		states[state.CodeList.CodeListName] = state
+	}
+	return states, nil
+}
+
+func versionIDs(versions []b2bapi.CodeList) []string {
+	ids := make([]string, 0, len(versions))
+	for _, codelist := range versions {
+		ids = append(ids, codelist.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// describeVersion returns the version, creation date and user of a code list
+// version, e.g. version 2 created 2019-05-16 17:08:52 by apiuser.
+func describeVersion(codelist b2bapi.CodeList) string {
+	text := fmt.Sprintf("version %d", codelist.VersionNumber)
+	if !codelist.CreateDate.IsZero() {
+		text += " created " + codelist.CreateDate.Format("2006-01-02 15:04:05")
+	}
+	if codelist.UserName != "" {
+		text += " by " + codelist.UserName
+	}
+	return text
+}
+
+// runDrift compares the code lists on B2Bi matching the patterns with the
+// state this tool last applied and reports the code lists changed, created
+// or deleted by someone else. With accept, the live state is recorded as
+// the applied state instead. The number of drifted code lists is returned.
+func (mgr *apiMgr) runDrift(patterns []string, accept bool) (int, error) {
+	states, err := mgr.loadStates()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the applied states in " + mgr.statedir + " " + err.Error())
+		return 0, err
+	}
+	codelists, err := mgr.listCodelists()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+		return 0, err
+	}
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, codelist := range codelists {
+		if !seen[codelist.CodeListName] {
+			seen[codelist.CodeListName] = true
+			names = append(names, codelist.CodeListName)
+		}
+	}
+	for name := range states {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names, unmatched := matchNames(names, patterns)
+	for _, pattern := range unmatched {
+		mgr.addError("ERROR: no Code List found for \"" + pattern + "\"")
+	}
+
+	drifted := 0
+	for _, name := range names {
+		mgr.codelist = name
+		versions, err := mgr.fetchCodelists()
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		if accept {
+			err = mgr.saveState(name, versions)
+			if err != nil {
+				mgr.addError("ERROR: unable to record the state of Code List \"" + name + "\" " + err.Error())
+				continue
+			}
+			fmt.Printf("Code List \"%s\": live state recorded as applied.\n", name)
+			continue
+		}
+		state, tracked := states[name]
+		resolved, err := store.ResolveVersion(name, versions)
+		if err != nil && err != store.ErrNotFound {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		found := err == nil
+		var live b2bapi.CodeList
+		if found {
+			live = *resolved
+		}
+		switch {
+		case !tracked:
+			fmt.Printf("Code List \"%s\": DRIFT, not applied by this tool, %s\n", name, describeVersion(live))
+		case !found:
+			fmt.Printf("Code List \"%s\": DRIFT, deleted outside this tool, applied %s\n", name, describeVersion(state.CodeList))
+		default:
+			plan := diffCodes(name, liveItems([]b2bapi.CodeList{state.CodeList}), liveItems([]b2bapi.CodeList{live}))
+			sameVersion := live.ID == state.CodeList.ID && live.UserName == state.CodeList.UserName && live.CreateDate.Equal(state.CodeList.CreateDate.Time)
+			sameVersions := strings.Join(versionIDs(versions), ",") == strings.Join(state.Versions, ",")
+			if sameVersion && sameVersions && !plan.hasChanges() {
+				fmt.Printf("Code List \"%s\": no drift (%s)\n", name, describeVersion(live))
+				continue
+			}
+			fmt.Printf("Code List \"%s\": DRIFT, changed outside this tool\n", name)
+			fmt.Printf("  live:    %s\n", describeVersion(live))
+			fmt.Printf("  applied: %s, recorded %s by %s\n", describeVersion(state.CodeList), state.AppliedAt.Format("2006-01-02 15:04:05"), state.AppliedBy)
+			if !sameVersions {
+				fmt.Printf("  versions: %s (applied %s)\n", strings.Join(versionIDs(versions), ", "), strings.Join(state.Versions, ", "))
+			}
+			plan.printChanges()
+		}
+		drifted++
+	}
+	if accept {
+		fmt.Printf("%d Code List(s) recorded in \"%s\".\n", len(names), mgr.statedir)
+	} else {
+		fmt.Printf("%d Code List(s) checked, %d drifted.\n", len(names), drifted)
+	}
+	if len(mgr.errorsList) > 0 {
+		return drifted, fmt.Errorf("Drift check failed")
+	}
+	return drifted, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDrift(t *testing.T) {
+	dir := t.TempDir()
+	fake, client := newFakeB2Bi(t)
+	fake.put("CHANGED", 1, 1, "A")
+	fake.put("DELETED", 1, 1, "D")
+	fake.put("SAME", 1, 0, "X")
+	fake.put("SAME", 2, 1, "S")
+	mgr := newJournalMgr(client, dir, "")
+	var drifted int
+	var err error
+	captureOutput(t, func() { drifted, err = mgr.runDrift(nil, true) })
+	if err != nil || drifted != 0 {
+		t.Fatalf("runDrift -accept returned %d %v %v", drifted, err, mgr.errorsList)
+	}
+
+	// someone else updates CHANGED, deletes DELETED and creates UNTRACKED
+	changed := fake.codelists["CHANGED|||1"]
+	changed.Codes = testCodes("A", "B")
+	changed.UserName = "someone"
+	fake.codelists["CHANGED|||1"] = changed
+	delete(fake.codelists, "DELETED|||1")
+	fake.put("UNTRACKED", 1, 1, "U")
+
+	mgr = newJournalMgr(client, dir, "")
+	output := captureOutput(t, func() { drifted, err = mgr.runDrift(nil, false) })
+	if err != nil || drifted != 3 {
+		t.Errorf("runDrift returned %d %v, want 3 drifted:\n%s", drifted, err, output)
+	}
+	for _, want := range []string{
+		"Code List \"CHANGED\": DRIFT, changed outside this tool\n  live:    version 1 by someone\n",
+		"Code List \"DELETED\": DRIFT, deleted outside this tool, applied version 1\n",
+		"Code List \"SAME\": no drift (version 2)\n",
+		"Code List \"UNTRACKED\": DRIFT, not applied by this tool, version 1\n",
+		"4 Code List(s) checked, 3 drifted.\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output has no %q:\n%s", want, output)
+		}
+	}
+
+	mgr = newJournalMgr(client, dir, "")
+	output = captureOutput(t, func() { drifted, err = mgr.runDrift([]string{"CHANGED"}, false) })
+	if err != nil || drifted != 1 || strings.Contains(output, "UNTRACKED") {
+		t.Errorf("runDrift of CHANGED returned %d %v:\n%s", drifted, err, output)
+	}
+
+	// the accepted live state is the new applied state
+	captureOutput(t, func() { drifted, err = mgr.runDrift(nil, true) })
+	if err != nil || fileExists(mgr.stateFile("DELETED")) {
+		t.Errorf("runDrift -accept returned %v, DELETED state kept %v", err, fileExists(mgr.stateFile("DELETED")))
+	}
+	output = captureOutput(t, func() { drifted, err = mgr.runDrift(nil, false) })
+	if err != nil || drifted != 0 || !strings.Contains(output, "3 Code List(s) checked, 0 drifted.") {
+		t.Errorf("runDrift after -accept returned %d %v:\n%s", drifted, err, output)
+	}
+}
+
+func TestDriftCommandExit(t *testing.T) {
+	if args := os.Getenv("CODELISTMGR_DRIFT"); args != "" {
+		driftCommand(strings.Split(args, " "))
+		return
+	}
+	dir := t.TempDir()
+	fake, client := newFakeB2Bi(t)
+	fake.put("LIST", 1, 1, "A")
+	conf := filepath.Join(dir, "apimgr.conf")
+	config := "[DEFAULT]\nusername = user\npassword = " + encrypt("password") + "\napiurl = " + client.BaseURL + "\n" +
+		"statedir = " + filepath.Join(dir, "state") + "\nbackupdir = " + filepath.Join(dir, "backup") + "\n"
+	if err := ioutil.WriteFile(conf, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		args     string
+		exitCode int
+	}{
+		// the exit status is cut to 8 bits, 10006 is seen as 118
+		{"drift", "-conf " + conf, 10006 % 256},
+		{"accept", "-conf " + conf + " -accept", 0},
+		{"no drift", "-conf " + conf, 0},
+	}
+	for _, test := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestDriftCommandExit$")
+		cmd.Env = append(os.Environ(), "CODELISTMGR_DRIFT="+test.args)
+		output, err := cmd.CombinedOutput()
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if exitCode != test.exitCode {
+			t.Errorf("%s: drift exited with %d, want %d\n%s", test.name, exitCode, test.exitCode, output)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+var exportInstructions = []string{
+	"This workbook was exported from Sterling B2B Integrator by the AMF CodeList Manager.",
+	"Each sheet below is a Code List, the sheet name is the Code List name.",
+	"The Active column holds the action of the row: Yes loads the code, No ignores the row.",
+	"A sheet using Add, Update, Delete or Keep is a change to the live Code List, the other live codes are kept.",
+	"The columns are found by the titles of the first row, they can be reordered and other columns are ignored.",
+	"Active, SenderCode and ReceiverCode are required, Description and Text1 to Text9 are optional.",
+	"Text columns may be titled with the names of the [schema:<code list name>] section of the configuration file.",
+	"Edit the codes and run \"codelistmgr update -input <this file>\" to push the Code Lists back.",
+}
+
+// runExport writes the active version of the code lists matching the given
+// patterns, or of all the code lists when there is none, into a workbook
+// that can be used as the input document of an update, or into a resource
+// manager XML file when format is xml.
+func (mgr *apiMgr) runExport(output, format string, patterns []string) error {
+	codelists, err := mgr.listCodelists()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+		return err
+	}
+	names, unmatched := matchNames(store.Names(codelists), patterns)
+	for _, pattern := range unmatched {
+		mgr.addError("ERROR: no Code List found for \"" + pattern + "\"")
+	}
+
+	exported := make([]b2bapi.CodeList, 0)
+	for _, name := range names {
+		if format != "xml" && !isSheetName(name) {
+			mgr.addError("ERROR: Code List \"" + name + "\" can not be used as a sheet name, not exported")
+			continue
+		}
+		mgr.codelist = name
+		versions, err := mgr.fetchCodelists()
+		if err != nil {
+			mgr.addError("ERROR: unable to export Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		codelist, err := store.ResolveVersion(name, versions)
+		if err != nil {
+			mgr.addError("ERROR: unable to export Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		exported = append(exported, *codelist)
+	}
+	if len(exported) > 0 {
+		if format == "xml" {
+			err = writeResourceXML(output, exported)
+		} else {
+			err = mgr.writeExportWorkbook(output, exported)
+		}
+		if err != nil {
+			mgr.addError("ERROR: unable to write " + output)
+			return err
+		}
+		fmt.Printf("%d Code List(s) exported to \"%s\".\n", len(exported), output)
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Export failed")
+	}
+	return nil
+}
+
+// isSheetName checks that a code list name can be used as a sheet name.
+func isSheetName(name string) bool {
+	return utf8.RuneCountInString(name) <= 31 && !strings.ContainsAny(name, ":\\/?*[]")
+}
+
+// writeExportWorkbook writes the codes of the code lists into a workbook
+// with one sheet per code list, the text columns are titled with the names
+// of the schema of the code list.
+func (mgr *apiMgr) writeExportWorkbook(output string, codelists []b2bapi.CodeList) error {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Instructions")
+	for i, line := range exportInstructions {
+		f.SetCellValue("Instructions", fmt.Sprintf("A%d", i+1), line)
+	}
+	for _, codelist := range codelists {
+		schema, schemaErrors := loadSchema(mgr.config, codelist.CodeListName)
+		for _, errormsg := range schemaErrors {
+			mgr.addError(errormsg)
+		}
+		writeCodesSheet(f, codelist.CodeListName, schema.header("Active"), codelist.Codes)
+	}
+	return f.SaveAs(output)
+}
+
+// matchNames returns the names matching one of the * and ? wildcard
+// patterns, or every name when there is no pattern, with the patterns that
+// matched none of them.
+func matchNames(names []string, patterns []string) ([]string, []string) {
+	if len(patterns) == 0 {
+		return names, nil
+	}
+	selected := make([]string, 0)
+	matched := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched[pattern] = true
+				found = true
+			}
+		}
+		if found {
+			selected = append(selected, name)
+		}
+	}
+	unmatched := make([]string, 0)
+	for _, pattern := range patterns {
+		if !matched[pattern] {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return selected, unmatched
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSheetName(t *testing.T) {
+	tests := map[string]bool{
+		"AMF_XREF_SAP_UOM":                 true,
+		"PARTNER_ROUTING_TABLE_FOR_EUROPE": false,
+		"Kundenstammdaten_Österreich_Süd":  true,
+		"Kundenstammdaten_Österreich_Süd1": false,
+		"仕入先コード変換表":                        true,
+		"EDI/X12:850":                      false,
+		"List[1]":                          false,
+	}
+	for name, want := range tests {
+		if got := isSheetName(name); got != want {
+			t.Errorf("isSheetName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMatchNames(t *testing.T) {
+	names := []string{"AMF_X", "AMF_XREF_SAP_UOM", "Zydus_SAP_Cust"}
+	tests := []struct {
+		name      string
+		patterns  []string
+		selected  []string
+		unmatched []string
+	}{
+		{"no pattern", nil, names, nil},
+		{"wildcard", []string{"AMF_*"}, []string{"AMF_X", "AMF_XREF_SAP_UOM"}, []string{}},
+		{"overlapping patterns", []string{"AMF_*", "AMF_XREF_SAP_UOM"}, []string{"AMF_X", "AMF_XREF_SAP_UOM"}, []string{}},
+		{"same name twice", []string{"Zydus_SAP_Cust", "*_SAP_*"}, []string{"AMF_XREF_SAP_UOM", "Zydus_SAP_Cust"}, []string{}},
+		{"unmatched pattern", []string{"AMF_X", "NONE*"}, []string{"AMF_X"}, []string{"NONE*"}},
+	}
+	for _, test := range tests {
+		selected, unmatched := matchNames(names, test.patterns)
+		if !reflect.DeepEqual(selected, test.selected) || !reflect.DeepEqual(unmatched, test.unmatched) {
+			t.Errorf("%s: matchNames = %v %v, want %v %v", test.name, selected, unmatched, test.selected, test.unmatched)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"codelistmgr/b2bapi"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// inputList is a code list of an input document, the first row holds the
+// column titles. The sheets of a workbook must have the action column.
+type inputList struct {
+	name     string
+	rows     [][]string
+	workbook bool
+}
+
+type inputReader func(path string) ([]inputList, error)
+
+// inputReaders are the readers of the input document formats, the format
+// is given by -format or by the extension of the input file.
+var inputReaders = map[string]inputReader{
+	"xlsx": readXLSXInput,
+	"csv":  readCSVInput(','),
+	"tsv":  readCSVInput('\t'),
+	"dir":  readDirInput,
+	"json": readJSONInput,
+	"yaml": readYAMLInput,
+	"xml":  readXMLInput,
+}
+
+// listNameColumn is the column of a CSV file holding the code list name,
+// without it the file name is the code list name.
+const listNameColumn = "codeListName"
+
+// inputFormat returns the format of an input document.
+func inputFormat(path, format string) (string, error) {
+	if format == "" {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return "dir", nil
+		}
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if format == "yml" {
+		format = "yaml"
+	}
+	if _, ok := inputReaders[format]; !ok {
+		return "", fmt.Errorf("unknown input format \"%s\" (xlsx, csv, tsv, json, yaml, xml or a directory of csv files)", format)
+	}
+	return format, nil
+}
+
+// readInput reads the code lists of an input document.
+func readInput(path, format string) ([]inputList, error) {
+	format, err := inputFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	return inputReaders[format](path)
+}
+
+func readXLSXInput(path string) ([]inputList, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lists := make([]inputList, 0)
+	for _, name := range sheetNames(f) {
+		if name == "Instructions" {
+			continue
+		}
+		lists = append(lists, inputList{name: name, rows: f.GetRows(name), workbook: true})
+	}
+	return lists, nil
+}
+
+func readCSVInput(comma rune) inputReader {
+	return func(path string) ([]inputList, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		var rows [][]string
+		if comma == '\t' {
+			rows, err = readTSVRows(file)
+		} else {
+			reader := csv.NewReader(file)
+			reader.FieldsPerRecord = -1
+			rows, err = reader.ReadAll()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, fmt.Errorf("%s is empty", path)
+		}
+		if len(rows[0]) > 0 {
+			rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+		}
+		nameCol := -1
+		for col, title := range rows[0] {
+			if columnTitle(title) == columnTitle(listNameColumn) {
+				nameCol = col
+			}
+		}
+		if nameCol < 0 {
+			name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				name = unescaped
+			}
+			return []inputList{{name: name, rows: rows}}, nil
+		}
+		return splitByListName(rows, nameCol)
+	}
+}
+
+// readTSVRows splits the lines of a TSV file on tabs, quotes have no
+// meaning in TSV and are kept in the values.
+func readTSVRows(file io.Reader) ([][]string, error) {
+	rows := make([][]string, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		rows = append(rows, strings.Split(line, "\t"))
+	}
+	return rows, scanner.Err()
+}
+
+// splitByListName groups the rows of a file holding several code lists by
+// the value of their code list name column.
+func splitByListName(rows [][]string, nameCol int) ([]inputList, error) {
+	header := removeColumn(rows[0], nameCol)
+	lists := make([]inputList, 0)
+	index := make(map[string]int)
+	for r, row := range rows[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		name := ""
+		if nameCol < len(row) {
+			name = strings.TrimSpace(row[nameCol])
+		}
+		if name == "" {
+			return nil, fmt.Errorf("missing %s at row %d", listNameColumn, r+2)
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(lists)
+			index[name] = i
+			lists = append(lists, inputList{name: name, rows: [][]string{header}})
+		}
+		lists[i].rows = append(lists[i].rows, removeColumn(row, nameCol))
+	}
+	return lists, nil
+}
+
+func removeColumn(row []string, col int) []string {
+	if col >= len(row) {
+		return row
+	}
+	return append(append([]string{}, row[:col]...), row[col+1:]...)
+}
+
+// readDirInput reads the csv, tsv, json and yaml files of a directory in
+// name order.
+func readDirInput(path string) ([]inputList, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	lists := make([]inputList, 0)
+	for _, name := range names {
+		var read inputReader
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".csv":
+			read = readCSVInput(',')
+		case ".tsv":
+			read = readCSVInput('\t')
+		case ".json":
+			read = readJSONInput
+		case ".yaml", ".yml":
+			read = readYAMLInput
+		default:
+			continue
+		}
+		fileLists, err := read(filepath.Join(path, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		lists = append(lists, fileLists...)
+	}
+	return lists, nil
+}
+
+// readJSONInput reads a code list, or an array of code lists, in the model
+// of the REST API.
+func readJSONInput(path string) ([]inputList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return codelistsInput(data)
+}
+
+// readYAMLInput reads a code list, or a sequence of code lists, with the
+// codeListName and codes fields of the JSON model. The codes are decoded as
+// strings, so 01 or 1.50 are kept as written.
+func readYAMLInput(path string) ([]inputList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	err = yaml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]listFile, 0)
+	if len(document.Content) > 0 && document.Content[0].Kind == yaml.SequenceNode {
+		err = document.Decode(&files)
+	} else {
+		var file listFile
+		err = document.Decode(&file)
+		files = append(files, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	codelists := make([]b2bapi.CodeList, 0, len(files))
+	for _, file := range files {
+		codelist := b2bapi.CodeList{CodeListName: file.CodeListName}
+		for _, code := range file.Codes {
+			codelist.Codes = append(codelist.Codes, b2bapi.Code(code))
+		}
+		codelists = append(codelists, codelist)
+	}
+	return codelistInputs(codelists)
+}
+
+func codelistsInput(data []byte) ([]inputList, error) {
+	codelists := make([]b2bapi.CodeList, 0)
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err := json.Unmarshal(data, &codelists)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var codelist b2bapi.CodeList
+		err := json.Unmarshal(data, &codelist)
+		if err != nil {
+			return nil, err
+		}
+		codelists = append(codelists, codelist)
+	}
+	return codelistInputs(codelists)
+}
+
+// codelistInputs converts code lists into input lists with the layout of
+// the input document.
+func codelistInputs(codelists []b2bapi.CodeList) ([]inputList, error) {
+	lists := make([]inputList, 0, len(codelists))
+	for i, codelist := range codelists {
+		if codelist.CodeListName == "" {
+			return nil, fmt.Errorf("missing codeListName in Code List %d", i+1)
+		}
+		rows := [][]string{listSchema(nil).header("Action")}
+		for _, code := range codelist.Codes {
+			item := itemFromCode(code)
+			rows = append(rows, append([]string{item.active, item.senderCode}, item.values()...))
+		}
+		lists = append(lists, inputList{name: codelist.CodeListName, rows: rows})
+	}
+	return lists, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inputString returns the code lists as "NAME: row; row", the trailing empty
+// cells of the rows are left out.
+func inputString(lists []inputList) string {
+	parts := make([]string, 0, len(lists))
+	for _, list := range lists {
+		rows := make([]string, 0, len(list.rows))
+		for _, row := range list.rows {
+			rows = append(rows, strings.TrimRight(strings.Join(row, ","), ","))
+		}
+		parts = append(parts, list.name+": "+strings.Join(rows, "; "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestReadInput(t *testing.T) {
+	header := "Action,SenderCode,ReceiverCode,Description,Text1,Text2,Text3,Text4,Text5,Text6,Text7,Text8,Text9"
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"csv", "LIST.csv", "\ufeffSenderCode,ReceiverCode\nA,\"R,A\"\n\nB,RB\n", "LIST: SenderCode,ReceiverCode; A,R,A; B,RB"},
+		{"csv escaped name", "AMF%2FLIST.csv", "SenderCode,ReceiverCode\nA,RA\n", "AMF/LIST: SenderCode,ReceiverCode; A,RA"},
+		{"csv codeListName column", "lists.csv", "codeListName,SenderCode,ReceiverCode\nONE,A,RA\nTWO,B,RB\nONE,C,RC\n", "ONE: SenderCode,ReceiverCode; A,RA; C,RC | TWO: SenderCode,ReceiverCode; B,RB"},
+		{"tsv", "LIST.tsv", "SenderCode\tReceiverCode\tDescription\r\nA\t\"RA\t5\" pipe\r\nB\tRB\t\"\r\n", "LIST: SenderCode,ReceiverCode,Description; A,\"RA,5\" pipe; B,RB,\""},
+		{"tsv codeListName column", "lists.tsv", "SenderCode\tcodeListName\tReceiverCode\nA\tONE\tRA\nB\tTWO\tRB\n", "ONE: SenderCode,ReceiverCode; A,RA | TWO: SenderCode,ReceiverCode; B,RB"},
+		{"json", "list.json", `{"codeListName": "LIST", "codes": [{"senderCode": "01", "receiverCode": "1.50", "text2": "x"}]}`, "LIST: " + header + "; Yes,01,1.50,,,x"},
+		{"json array", "lists.json", `[{"codeListName": "ONE", "codes": [{"senderCode": "A", "receiverCode": "RA"}]}, {"codeListName": "TWO"}]`, "ONE: " + header + "; Yes,A,RA | TWO: " + header},
+		{"yaml", "list.yaml", "codeListName: LIST\ncodes:\n  - senderCode: 01\n    receiverCode: 1.50\n    description: 14\n", "LIST: " + header + "; Yes,01,1.50,14"},
+		{"yaml sequence", "lists.yml", "- codeListName: ONE\n  codes:\n    - {senderCode: 007, receiverCode: true}\n- codeListName: TWO\n", "ONE: " + header + "; Yes,007,true | TWO: " + header},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.file)
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		lists, err := readInput(path, "")
+		if err != nil {
+			t.Errorf("%s: readInput: %v", test.name, err)
+			continue
+		}
+		if got := inputString(lists); got != test.want {
+			t.Errorf("%s: read %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadInputErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"empty csv", "LIST.csv", "", "is empty"},
+		{"missing list name", "lists.csv", "codeListName,SenderCode,ReceiverCode\nONE,A,RA\n,B,RB\n", "missing codeListName at row 3"},
+		{"json without name", "list.json", `{"codes": []}`, "missing codeListName in Code List 1"},
+		{"yaml without name", "list.yaml", "- codeListName: ONE\n- codes: []\n", "missing codeListName in Code List 2"},
+		{"unknown format", "list.txt", "A", "unknown input format \"txt\""},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.file)
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := readInput(path, "")
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: readInput returned %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestReadDirInput(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"A.csv":     "SenderCode,ReceiverCode\nA,RA\n",
+		"B.tsv":     "SenderCode\tReceiverCode\nB\tRB\n",
+		"c.json":    `{"codeListName": "C", "codes": [{"senderCode": "C", "receiverCode": "RC"}]}`,
+		"d.yaml":    "codeListName: D\ncodes:\n  - {senderCode: 01, receiverCode: RD}\n",
+		"notes.txt": "not a code list",
+		"sub/E.csv": "SenderCode,ReceiverCode\nE,RE\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lists, err := readInput(dir, "")
+	if err != nil {
+		t.Fatalf("readInput: %v", err)
+	}
+	names := make([]string, 0, len(lists))
+	for _, list := range lists {
+		names = append(names, list.name+"="+list.rows[1][1])
+	}
+	if got := strings.Join(names, " "); got != "A=RA B=RB C=C D=01" {
+		t.Errorf("read %s, want A=RA B=RB C=C D=01", got)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readInput(dir, ""); err == nil || !strings.HasPrefix(err.Error(), "broken.json: ") {
+		t.Errorf("readInput of a directory with a broken file returned %v", err)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Steps of a run journal.
+const (
+	stepStart      = "start"
+	stepResume     = "resume"
+	stepBackup     = "backup"
+	stepBackupFile = "backupfile"
+	stepDeleted    = "deleted"
+	stepApplied    = "applied"
+	stepVerified   = "verified"
+	stepFailed     = "failed"
+	stepFinished   = "finished"
+	stepRollback   = "rollback"
+)
+
+// journalEntry is a line of a run journal, the hash is the SHA-256 of the
+// codes of the step in sender code order.
+type journalEntry struct {
+	Time     b2bapi.Timestamp `json:"time"`
+	Step     string           `json:"step"`
+	List     string           `json:"list,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Hash     string           `json:"hash,omitempty"`
+	Detail   string           `json:"detail,omitempty"`
+	Input    string           `json:"input,omitempty"`
+	Format   string           `json:"format,omitempty"`
+	Strategy string           `json:"strategy,omitempty"`
+	Backup   string           `json:"backup,omitempty"`
+	Versions []string         `json:"versions,omitempty"`
+}
+
+// runJournal is the append-only journal of an update run, kept as
+// <journaldir>/<run id>.jsonl. Every entry is written to disk before the
+// run goes on.
+type runJournal struct {
+	id      string
+	path    string
+	entries []journalEntry
+}
+
+func journalPath(dir, runID string) string {
+	return filepath.Join(dir, runID+".jsonl")
+}
+
+// newJournal creates the journal of a new run, a suffix is added to the run
+// id when a run, or a backup file in bkpdir, has the same id.
+func newJournal(dir, bkpdir, runID string) (*runJournal, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	id := runID
+	for n := 2; ; n++ {
+		if fileExists(filepath.Join(bkpdir, "bkp_codelist_"+id+".xlsx")) {
+			id = fmt.Sprintf("%s_%d", runID, n)
+			continue
+		}
+		f, err := os.OpenFile(journalPath(dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return &runJournal{id: id, path: journalPath(dir, id)}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s_%d", runID, n)
+	}
+}
+
+// openJournal reads the journal of an earlier run, the entries of a resume
+// are appended to it.
+func openJournal(dir, runID string) (*runJournal, error) {
+	journal := &runJournal{id: runID, path: journalPath(dir, runID)}
+	f, err := os.Open(journal.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry journalEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// the last line of a run killed while writing it is ignored
+			fmt.Printf("WARNING: %s line %d ignored, %s\n", journal.path, line, err.Error())
+			continue
+		}
+		journal.entries = append(journal.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(journal.entries) == 0 || journal.entries[0].Step != stepStart {
+		return nil, fmt.Errorf("%s is not a run journal", journal.path)
+	}
+	return journal, nil
+}
+
+// add appends an entry to the journal file and syncs it.
+func (journal *runJournal) add(entry journalEntry) error {
+	entry.Time = b2bapi.Timestamp{Time: time.Now()}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(journal.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	journal.entries = append(journal.entries, entry)
+	return nil
+}
+
+// start returns the first entry of the journal.
+func (journal *runJournal) start() journalEntry {
+	return journal.entries[0]
+}
+
+// last returns the last entry of a step, for a code list when list is not
+// empty.
+func (journal *runJournal) last(step, list string) (journalEntry, bool) {
+	for i := len(journal.entries) - 1; i >= 0; i-- {
+		entry := journal.entries[i]
+		if entry.Step == step && (list == "" || entry.List == list) {
+			return entry, true
+		}
+	}
+	return journalEntry{}, false
+}
+
+// done reports whether a step was journaled, for a code list when list is
+// not empty.
+func (journal *runJournal) done(step, list string) bool {
+	_, ok := journal.last(step, list)
+	return ok
+}
+
+// deleted reports whether a version was deleted by the run.
+func (journal *runJournal) deleted(id string) bool {
+	for _, entry := range journal.entries {
+		if entry.Step == stepDeleted && entry.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// touched returns the code lists the run deleted versions of or applied
+// codes to.
+func (journal *runJournal) touched() []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, entry := range journal.entries {
+		if (entry.Step == stepDeleted || entry.Step == stepApplied) && !seen[entry.List] {
+			seen[entry.List] = true
+			names = append(names, entry.List)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// codesHash returns the SHA-256 of the codes in sender code order.
+func codesHash(codes []b2bapi.Code) string {
+	sorted := append([]b2bapi.Code{}, codes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].SenderCode < sorted[j].SenderCode })
+	data, _ := json.Marshal(sorted)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// inputHash returns the SHA-256 of the code lists of an input document.
+func inputHash(lists []inputList) string {
+	rows := make(map[string][][]string, len(lists))
+	for _, list := range lists {
+		rows[list.name] = list.rows
+	}
+	data, _ := json.Marshal(rows)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// journal adds an entry to the journal of the run, a failure to write it
+// stops the run since it could not be resumed.
+func (mgr *apiMgr) journal(entry journalEntry) {
+	if mgr.run == nil {
+		return
+	}
+	err := mgr.run.add(entry)
+	if err != nil {
+		mgr.addError("ERROR: unable to write the run journal " + mgr.run.path + " " + err.Error())
+		mgr.showErrors("")
+		os.Exit(10003)
+	}
+}
+
+// verifyCodelist checks that the version of the current code list used by
+// the update API holds the codes of the hash, the result is journaled.
+func (mgr *apiMgr) verifyCodelist(hash string) bool {
+	versions, err := mgr.fetchCodelists()
+	if err == nil {
+		var codelist *b2bapi.CodeList
+		codelist, err = store.ResolveVersion(mgr.codelist, versions)
+		if err == nil && codesHash(codelist.Codes) != hash {
+			err = fmt.Errorf("the codes of %s differ from the codes sent", codelist.ID)
+		}
+		if err == nil {
+			mgr.journal(journalEntry{Step: stepVerified, List: mgr.codelist, ID: codelist.ID, Hash: hash})
+			return true
+		}
+	}
+	mgr.journal(journalEntry{Step: stepFailed, List: mgr.codelist, Hash: hash, Detail: "verification failed: " + err.Error()})
+	fmt.Println("ERROR: Code List \"" + mgr.codelist + "\" not verified " + err.Error())
+	return false
+}
+
+// readBackupVersions reads the versions saved in a backup file, the
+// versions active at backup time are given by the backup steps of the
+// journal.
+func (mgr *apiMgr) readBackupVersions(journal *runJournal) (map[string][]b2bapi.CodeList, error) {
+	backups := make(map[string][]b2bapi.CodeList)
+	active := make(map[string]bool)
+	for _, entry := range journal.entries {
+		if entry.Step == stepBackup {
+			backups[entry.List] = make([]b2bapi.CodeList, 0)
+			if entry.ID != "" {
+				active[entry.ID] = true
+			}
+		}
+	}
+	f, err := excelize.OpenFile(journal.start().Backup)
+	if err != nil {
+		return nil, err
+	}
+	sheets, sheetErrors := readBackupSheets(f)
+	if len(sheetErrors) > 0 {
+		for _, errormsg := range sheetErrors {
+			mgr.addError(errormsg)
+		}
+		return nil, fmt.Errorf("with %d invalid sheet(s)", len(sheetErrors))
+	}
+	for _, sheet := range sheets {
+		items, _ := readCodelistRows(sheet.id, f.GetRows(sheet.sheet), mgr.columns, true)
+		codelist := b2bapi.CodeList{ID: sheet.id, CodeListName: sheet.name, VersionNumber: sheet.version, Codes: apiCodes(items)}
+		if active[sheet.id] {
+			codelist.ListStatus = 1
+		}
+		backups[sheet.name] = append(backups[sheet.name], codelist)
+	}
+	return backups, nil
+}
+
+// runResume continues an update run that stopped before it finished, the
+// code lists already verified are skipped and the versions already deleted
+// are not deleted again.
+func (mgr *apiMgr) runResume(runID string) error {
+	journal, err := openJournal(mgr.journaldir, runID)
+	if err != nil {
+		mgr.addError("ERROR: unable to read run " + runID + " " + err.Error())
+		return err
+	}
+	if journal.done(stepFinished, "") {
+		fmt.Println("Run " + runID + " has already finished, nothing to resume.")
+		return nil
+	}
+	start := journal.start()
+	lists, err := readInput(start.Input, start.Format)
+	if err != nil {
+		mgr.addError("ERROR - Invalid input file [" + start.Input + "] " + err.Error())
+		return err
+	}
+	if inputHash(lists) != start.Hash {
+		mgr.addError("ERROR: the input document " + start.Input + " changed since run " + runID + " started, it can not be resumed")
+		return fmt.Errorf("Resume failed")
+	}
+	mgr.infile = start.Input
+	mgr.format = start.Format
+	mgr.strategy = start.Strategy
+	mgr.bkpdir = filepath.Dir(start.Backup)
+	mgr.bkpfile = filepath.Base(start.Backup)
+	mgr.run = journal
+	return mgr.runUpdate()
+}
+
+// runRollback restores the code lists touched by a run from the backup
+// taken by the run, the code lists it created are deleted.
+func (mgr *apiMgr) runRollback(runID string, selection []string) error {
+	journal, err := openJournal(mgr.journaldir, runID)
+	if err != nil {
+		mgr.addError("ERROR: unable to read run " + runID + " " + err.Error())
+		return err
+	}
+	if !journal.done(stepBackupFile, "") {
+		mgr.addError("ERROR: run " + runID + " stopped before its backup was saved, nothing was changed")
+		return fmt.Errorf("Rollback failed")
+	}
+	names, unmatched := matchNames(journal.touched(), selection)
+	for _, pattern := range unmatched {
+		mgr.addError("ERROR: Code List \"" + pattern + "\" was not changed by run " + runID)
+	}
+	if len(names) == 0 {
+		mgr.addError("ERROR: no Code List to roll back in run " + runID)
+		return fmt.Errorf("Rollback failed")
+	}
+	mgr.run = journal
+	mgr.bkpfile = uniqueBackupFile(mgr.bkpdir, "bkp_codelist_"+runID+"_rollback")
+	restore := make([]string, 0, len(names))
+	for _, name := range names {
+		entry, ok := journal.last(stepBackup, name)
+		if !ok {
+			mgr.addError("ERROR: Code List \"" + name + "\" has no backup in run " + runID + ", left unchanged")
+			continue
+		}
+		if len(entry.Versions) > 0 {
+			restore = append(restore, name)
+			continue
+		}
+		// the code list did not exist before the run
+		mgr.codelist = name
+		versions, err := mgr.fetchCodelists()
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		for _, codelist := range versions {
+			if err := mgr.deleteCodelist(codelist.ID); err != nil {
+				mgr.addError("ERROR: unable to delete \"" + codelist.ID + "\" " + err.Error())
+				continue
+			}
+			fmt.Printf("%s deleted, the Code List was created by run %s.\n", codelist.ID, runID)
+		}
+		mgr.recordApplied()
+		mgr.journal(journalEntry{Step: stepRollback, List: name, Detail: "deleted"})
+	}
+	if len(restore) > 0 {
+		if err := mgr.runRestore(journal.start().Backup, restore); err != nil {
+			return err
+		}
+		for _, name := range restore {
+			mgr.journal(journalEntry{Step: stepRollback, List: name, Detail: "restored from " + journal.start().Backup})
+		}
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Rollback failed")
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"encoding/json"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeB2Bi keeps the code list versions of a B2Bi instance in memory, the
+// next failPost create calls and failUpdate bulk updates are answered with
+// 503. When set, before is called with every request before it is served.
+type fakeB2Bi struct {
+	sync.Mutex
+	codelists  map[string]b2bapi.CodeList
+	requests   map[string]int
+	failPost   int
+	failUpdate int
+	before     func(r *http.Request)
+}
+
+func newFakeB2Bi(t *testing.T) (*fakeB2Bi, *b2bapi.Client) {
+	fake := &fakeB2Bi{codelists: make(map[string]b2bapi.CodeList), requests: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, b2bapi.NewClient(server.URL, "user", "password", b2bapi.Options{})
+}
+
+// put adds a version of a code list with the given sender codes.
+func (f *fakeB2Bi) put(name string, version, status int, senderCodes ...string) {
+	id := name + "|||" + strconv.Itoa(version)
+	f.codelists[id] = b2bapi.CodeList{ID: id, CodeListName: name, VersionNumber: version, ListStatus: status, Codes: testCodes(senderCodes...)}
+}
+
+// versions returns the versions of a code list by version number.
+func (f *fakeB2Bi) versions(name string) []b2bapi.CodeList {
+	f.Lock()
+	defer f.Unlock()
+	versions := make([]b2bapi.CodeList, 0)
+	for _, codelist := range f.codelists {
+		if codelist.CodeListName == name {
+			versions = append(versions, codelist)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNumber < versions[j].VersionNumber })
+	return versions
+}
+
+func (f *fakeB2Bi) reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeB2Bi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests[r.Method]++
+	if f.before != nil {
+		f.before(r)
+	}
+	segments := make([]string, 0)
+	for _, raw := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/B2BAPIs/svc/codelists/"), "/") {
+		if segment, err := url.PathUnescape(raw); err == nil && segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	switch {
+	case r.Method == "HEAD" && len(segments) == 0:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "GET" && len(segments) == 0:
+		name := r.URL.Query().Get("codeListName")
+		codelists := make([]b2bapi.CodeList, 0)
+		for _, codelist := range f.codelists {
+			if name == "" || codelist.CodeListName == name {
+				codelists = append(codelists, codelist)
+			}
+		}
+		sort.Slice(codelists, func(i, j int) bool { return codelists[i].ID < codelists[j].ID })
+		f.reply(w, http.StatusOK, codelists)
+	case r.Method == "POST" && len(segments) == 0:
+		if f.failPost > 0 {
+			f.failPost--
+			f.reply(w, http.StatusServiceUnavailable, "unavailable")
+			return
+		}
+		var create b2bapi.CreateRequest
+		json.NewDecoder(r.Body).Decode(&create)
+		version, status := 1, 1
+		for _, codelist := range f.codelists {
+			if codelist.CodeListName == create.CodeListName {
+				status = create.ListStatus
+				if codelist.VersionNumber >= version {
+					version = codelist.VersionNumber + 1
+				}
+			}
+		}
+		id := create.CodeListName + "|||" + strconv.Itoa(version)
+		f.codelists[id] = b2bapi.CodeList{ID: id, CodeListName: create.CodeListName, VersionNumber: version, ListStatus: status, Codes: create.Codes}
+		f.reply(w, http.StatusCreated, nil)
+	case r.Method == "POST" && len(segments) == 3 && segments[2] == "bulkupdatecodes":
+		if f.failUpdate > 0 {
+			f.failUpdate--
+			f.reply(w, http.StatusServiceUnavailable, "unavailable")
+			return
+		}
+		codelist, ok := f.codelists[segments[0]]
+		if !ok {
+			f.reply(w, http.StatusNotFound, "not found")
+			return
+		}
+		var update b2bapi.BulkUpdateRequest
+		json.NewDecoder(r.Body).Decode(&update)
+		codelist.Codes = update.Codes
+		f.codelists[segments[0]] = codelist
+		f.reply(w, http.StatusOK, nil)
+	case r.Method == "PUT" && len(segments) == 1:
+		codelist, ok := f.codelists[segments[0]]
+		if !ok {
+			f.reply(w, http.StatusNotFound, "not found")
+			return
+		}
+		var update b2bapi.UpdateRequest
+		json.NewDecoder(r.Body).Decode(&update)
+		for id, other := range f.codelists {
+			if other.CodeListName == codelist.CodeListName && update.ListStatus == 1 {
+				other.ListStatus = 0
+				f.codelists[id] = other
+			}
+		}
+		codelist.ListStatus = update.ListStatus
+		f.codelists[segments[0]] = codelist
+		f.reply(w, http.StatusOK, nil)
+	case r.Method == "DELETE" && len(segments) == 1:
+		if _, ok := f.codelists[segments[0]]; !ok {
+			f.reply(w, http.StatusNotFound, "not found")
+			return
+		}
+		delete(f.codelists, segments[0])
+		f.reply(w, http.StatusOK, nil)
+	default:
+		f.reply(w, http.StatusBadRequest, "unexpected "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func testCodes(senderCodes ...string) []b2bapi.Code {
+	codes := make([]b2bapi.Code, 0, len(senderCodes))
+	for _, senderCode := range senderCodes {
+		codes = append(codes, b2bapi.Code{SenderCode: senderCode, ReceiverCode: "R" + senderCode})
+	}
+	return codes
+}
+
+func versionCodes(codelist b2bapi.CodeList) string {
+	codes := make([]string, 0, len(codelist.Codes))
+	for _, code := range codelist.Codes {
+		codes = append(codes, code.SenderCode)
+	}
+	return strings.Join(codes, ",")
+}
+
+// newJournalMgr returns a manager of the fake B2Bi keeping its backups,
+// states and journals in dir.
+func newJournalMgr(client *b2bapi.Client, dir, strategy string) *apiMgr {
+	columns, _ := loadColumnAliases(nil)
+	mgr := &apiMgr{
+		username:   "user",
+		client:     client,
+		columns:    columns,
+		strategy:   strategy,
+		bkpdir:     filepath.Join(dir, "backup"),
+		statedir:   filepath.Join(dir, "state"),
+		journaldir: filepath.Join(dir, "journal"),
+		bkpfileptr: excelize.NewFile(),
+	}
+	mgr.bkpfile = uniqueBackupFile(mgr.bkpdir, "bkp_codelist_run")
+	os.MkdirAll(mgr.bkpdir, os.ModePerm)
+	return mgr
+}
+
+// writeInput writes a CSV file per code list into a new input directory.
+func writeInput(t *testing.T, dir string, lists map[string]string) string {
+	input := filepath.Join(dir, "input")
+	if err := os.MkdirAll(input, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, rows := range lists {
+		if err := ioutil.WriteFile(filepath.Join(input, name+".csv"), []byte("SenderCode,ReceiverCode\n"+rows), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return input
+}
+
+func TestResumeAfterDelete(t *testing.T) {
+	dir := t.TempDir()
+	fake, client := newFakeB2Bi(t)
+	fake.put("LIST", 1, 0, "A")
+	fake.put("LIST", 2, 1, "A", "B")
+	mgr := newJournalMgr(client, dir, strategyReplace)
+	mgr.infile = writeInput(t, dir, map[string]string{"LIST": "C,RC\nD,RD\n"})
+
+	// the create fails after both versions are deleted, the journal is then
+	// cut after the last delete as if the run was killed there
+	fake.failPost = 1
+	if err := mgr.runUpdate(); err == nil {
+		t.Fatal("runUpdate with a failed create returned no error")
+	}
+	runID := mgr.run.id
+	entries := mgr.run.entries
+	last := 0
+	for i, entry := range entries {
+		if entry.Step == stepDeleted {
+			last = i
+		}
+	}
+	if entries[last].ID != "LIST|||2" || len(fake.versions("LIST")) != 0 {
+		t.Fatalf("run stopped with versions %+v and journal %+v", fake.versions("LIST"), entries)
+	}
+	lines := make([]string, 0, last+1)
+	for _, entry := range entries[:last+1] {
+		data, _ := json.Marshal(entry)
+		lines = append(lines, string(data))
+	}
+	if err := ioutil.WriteFile(journalPath(mgr.journaldir, runID), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deletes := fake.requests["DELETE"]
+	mgr = newJournalMgr(client, dir, "")
+	if err := mgr.runResume(runID); err != nil {
+		t.Fatalf("runResume: %v %v", err, mgr.errorsList)
+	}
+	if fake.requests["DELETE"] != deletes {
+		t.Errorf("resume sent %d DELETE requests, want none", fake.requests["DELETE"]-deletes)
+	}
+	versions := fake.versions("LIST")
+	if len(versions) != 1 || versions[0].ListStatus != 1 || versionCodes(versions[0]) != "C,D" {
+		t.Errorf("LIST resumed as %+v, want one active version with C,D", versions)
+	}
+	journal, err := openJournal(mgr.journaldir, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !journal.done(stepResume, "") || !journal.done(stepVerified, "LIST") || !journal.done(stepFinished, "") {
+		t.Errorf("journal of the resumed run %+v", journal.entries)
+	}
+
+	// a finished run is not resumed again
+	posts := fake.requests["POST"]
+	if err := newJournalMgr(client, dir, "").runResume(runID); err != nil || fake.requests["POST"] != posts {
+		t.Errorf("resume of a finished run returned %v and sent %d POST requests", err, fake.requests["POST"]-posts)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	fake, client := newFakeB2Bi(t)
+	fake.put("LIST", 1, 1, "A", "B")
+	fake.put("LIST", 2, 0, "C")
+	fake.put("OTHER", 1, 1, "X")
+	mgr := newJournalMgr(client, dir, strategyReplace)
+	mgr.infile = writeInput(t, dir, map[string]string{"LIST": "D,RD\n", "NEW": "N,RN\n"})
+	if err := mgr.runUpdate(); err != nil {
+		t.Fatalf("runUpdate: %v %v", err, mgr.errorsList)
+	}
+	runID := mgr.run.id
+	if versions := fake.versions("LIST"); len(versions) != 1 || versionCodes(versions[0]) != "D" || len(fake.versions("NEW")) != 1 {
+		t.Fatalf("run left LIST %+v and NEW %+v", versions, fake.versions("NEW"))
+	}
+
+	mgr = newJournalMgr(client, dir, "")
+	if err := mgr.runRollback(runID, nil); err != nil {
+		t.Fatalf("runRollback: %v %v", err, mgr.errorsList)
+	}
+	versions := fake.versions("LIST")
+	if len(versions) != 2 || versionCodes(versions[0]) != "A,B" || versions[0].ListStatus != 1 || versionCodes(versions[1]) != "C" || versions[1].ListStatus != 0 {
+		t.Errorf("LIST rolled back as %+v, want active A,B and inactive C", versions)
+	}
+	if versions := fake.versions("NEW"); len(versions) != 0 {
+		t.Errorf("NEW created by the run left as %+v", versions)
+	}
+	if versions := fake.versions("OTHER"); len(versions) != 1 || versionCodes(versions[0]) != "X" {
+		t.Errorf("OTHER not in the run changed to %+v", versions)
+	}
+	if !fileExists(filepath.Join(mgr.bkpdir, mgr.bkpfile)) || mgr.bkpfile == "bkp_codelist_"+runID+".xlsx" {
+		t.Errorf("rollback backup file %s", mgr.bkpfile)
+	}
+	journal, err := openJournal(mgr.journaldir, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"LIST", "NEW"} {
+		if !journal.done(stepRollback, name) {
+			t.Errorf("rollback of %s not journaled: %+v", name, journal.entries)
+		}
+	}
+}
+
+func TestUpdateWithInvalidBackup(t *testing.T) {
+	dir := t.TempDir()
+	fake, client := newFakeB2Bi(t)
+	fake.put("LIST", 1, 1, "A")
+	// a version with an _id the backup cannot be read back with
+	fake.codelists["LIST|||v2"] = b2bapi.CodeList{ID: "LIST|||v2", CodeListName: "LIST", VersionNumber: 2, Codes: testCodes("B")}
+	mgr := newJournalMgr(client, dir, strategyReplace)
+	mgr.infile = writeInput(t, dir, map[string]string{"LIST": "C,RC\n"})
+	err := mgr.runUpdate()
+	if err == nil || !strings.Contains(err.Error(), "no Code List has been deleted") {
+		t.Fatalf("runUpdate returned %v, want an invalid backup error", err)
+	}
+	if fake.requests["DELETE"] != 0 || fake.requests["POST"] != 0 || len(fake.versions("LIST")) != 2 {
+		t.Errorf("runUpdate sent %d DELETE and %d POST requests, LIST left as %+v", fake.requests["DELETE"], fake.requests["POST"], fake.versions("LIST"))
+	}
+	if len(mgr.errorsList) != 1 || !strings.Contains(mgr.errorsList[0], "invalid Code List version in \"LIST|||v2\"") {
+		t.Errorf("errors %v", mgr.errorsList)
+	}
+}
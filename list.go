@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// runList prints the active version of every code list, or every version
+// when versions is set.
+func (mgr *apiMgr) runList(versions bool) error {
+	codelists, err := mgr.listCodelists()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+		return err
+	}
+	sort.Slice(codelists, func(i, j int) bool {
+		if codelists[i].CodeListName != codelists[j].CodeListName {
+			return codelists[i].CodeListName < codelists[j].CodeListName
+		}
+		return codelists[i].VersionNumber < codelists[j].VersionNumber
+	})
+	fmt.Printf("%-40s %8s %8s %-20s %s\n", "Code List", "Version", "Status", "Created", "User")
+	count := 0
+	for _, codelist := range codelists {
+		if !versions && codelist.ListStatus != 1 {
+			continue
+		}
+		created := ""
+		if !codelist.CreateDate.IsZero() {
+			created = codelist.CreateDate.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-40s %8d %8d %-20s %s\n", codelist.CodeListName, codelist.VersionNumber, codelist.ListStatus, created, codelist.UserName)
+		count++
+	}
+	fmt.Printf("%d Code List(s) found.\n", count)
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	amf_crypto "github.com/mft-labs/amf_crypto"
 	"gopkg.in/ini.v1"
+	"io/ioutil"
 	"os"
+	"strings"
 )
 
 var errorsList = make([]string, 0)
@@ -22,6 +24,27 @@ func loadConfig(fname string) *ini.File {
 	return newconfig
 }
 
+// updatePassword stores the encrypted password in the DEFAULT section of the
+// configuration file, the previous file is kept as <conf>.<timestamp>.bak.
+func updatePassword(conf, encrypted string) (string, error) {
+	config, err := ini.Load(conf)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(conf)
+	if err != nil {
+		return "", err
+	}
+	bkpfile := conf + "." + formattedCurTimeStamp("20060102_150405") + ".bak"
+	err = ioutil.WriteFile(bkpfile, data, 0600)
+	if err != nil {
+		return "", err
+	}
+	config.Section("DEFAULT").Key("password").SetValue(encrypted)
+	ini.DefaultHeader = true
+	return bkpfile, config.SaveTo(conf)
+}
+
 func encrypt(text string) string {
 	encrypted, err := amf_crypto.Encrypt(text)
 	if err != nil {
@@ -31,33 +54,29 @@ func encrypt(text string) string {
 }
 
 func main() {
-	var conf string
-	var input string
-	//var action string
-	//flag.StringVar(&action, "action", "", "action (encrypt/bulkupdate)")
-	flag.StringVar(&input, "input", "", "input file name")
-	flag.StringVar(&conf, "conf", "", "configuration file name")
-	flag.Parse()
-
-	if conf == "" && input == "" {
+	if len(os.Args) < 2 {
 		showUsage()
 		os.Exit(10001)
 	}
-
-	if conf == "" {
-		conf = "apimgr.conf"
+	name := os.Args[1]
+	args := os.Args[2:]
+	if strings.HasPrefix(name, "-") && name != "-h" && name != "-help" && name != "--help" {
+		// the options of the original command line are those of update
+		name = "update"
+		args = os.Args[1:]
 	}
-	if input == "" {
-		errorsList = append(errorsList, "Missing input document")
+	if name == "help" && len(args) > 0 {
+		name = args[0]
+		args = []string{"-h"}
 	}
-	validateInputs(conf, input)
-	if len(errorsList) == 0 {
-		manageBulkUpdate(conf, input)
-	} else {
-		showErrors("")
-		os.Exit(10001)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(args)
+			return
+		}
 	}
-
+	showUsage()
+	os.Exit(10001)
 }
 
 func fileExists(filename string) bool {
@@ -79,23 +98,95 @@ func validateInputs(conf, infile string) {
 	}
 }
 
-func manageBulkUpdate(conf, infile string) {
+// newFlagSet creates the flag set of a command, its help text shows the
+// usage line followed by the description and the flags of the command.
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("AMF CodeList Manager")
+		fmt.Println("======================================================================")
+		fmt.Println("Usage:")
+		fmt.Printf("%s %s %s\n\n", os.Args[0], name, usage)
+		fmt.Printf("%s\n\n", description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// newService loads the configuration file and checks the connection to
+// B2Bi, a read only service does not create the backup directory.
+func newService(conf string, readOnly bool) *apiMgr {
 	service := &apiMgr{}
-	service.infile = infile
+	service.readOnly = readOnly
+	return startService(service, conf)
+}
+
+// newOfflineService returns a service that does not connect to B2Bi, the
+// configuration file is only read for the columns and schemas when it exists.
+func newOfflineService(conf string) *apiMgr {
+	service := &apiMgr{errorsList: make([]string, 0)}
+	if fileExists(conf) {
+		service.config = loadConfig(conf)
+	}
+	var columnErrors []string
+	service.columns, columnErrors = loadColumnAliases(service.config)
+	service.errorsList = append(service.errorsList, columnErrors...)
+	return service
+}
+
+// startService initializes the service from the configuration file, the
+// program exits when it can not be initialized.
+func startService(service *apiMgr, conf string) *apiMgr {
+	validateInputs(conf, "")
+	if len(errorsList) > 0 {
+		showErrors("")
+		os.Exit(10001)
+	}
 	service.config = loadConfig(conf)
 	service.errorsList = make([]string, 0)
 	err := service.init()
-	if err == nil {
+	if err != nil {
+		errorsList = service.errorsList
+		showErrors("ERROR: Missing keys or DEFAULT section in config file")
+		os.Exit(10002)
+	}
+	return service
+}
+
+// splitList splits a comma separated list of names.
+func splitList(list string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) != "" {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	return names
+}
+
+func manageBulkUpdate(conf, infile, format string, plan bool, strategy string) {
+	service := &apiMgr{}
+	service.readOnly = plan
+	service.strategy = strategy
+	service = startService(service, conf)
+	service.infile = infile
+	service.format = format
+	var err error
+	if plan {
+		err = service.runPlan()
+		if err != nil {
+			errorsList = service.errorsList
+			showErrors("ERROR: CodeList plan failed")
+			os.Exit(10003)
+		}
+	} else {
 		err = service.runUpdate()
 		if err != nil {
 			errorsList = service.errorsList
 			showErrors("ERROR: CodeList update failed")
 			os.Exit(10003)
 		}
-	} else {
-		errorsList = service.errorsList
-		showErrors("ERROR: Missing keys or DEFAULT section in config file")
-		os.Exit(10002)
 	}
 
 }
@@ -105,8 +196,13 @@ func showUsage() {
 	fmt.Println("======================================================================")
 	fmt.Printf("Invalid request\n\n")
 	fmt.Println("Usage:")
-	fmt.Printf("%s [-conf <config filename>] -input <input XLSX document>\n", os.Args[0])
-	fmt.Printf("\nconfiguration file is optional, apimgr.conf is assumed as the default configuration file.")
+	fmt.Printf("%s <command> [options]\n\n", os.Args[0])
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Printf("\nRun \"%s help <command>\" for the options of a command.", os.Args[0])
+	fmt.Printf("\nconfiguration file is optional, apimgr.conf is assumed as the default configuration file.\n")
 }
 
 func showErrors(title string) {
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"os"
+	"sort"
+	"strings"
+)
+
+var codeFieldNames = []string{"receiverCode", "description", "text1", "text2", "text3", "text4", "text5", "text6", "text7", "text8", "text9"}
+
+type fieldChange struct {
+	field string
+	old   string
+	new   string
+}
+
+type codeChange struct {
+	senderCode string
+	item       codelistItem
+	fields     []fieldChange
+}
+
+func (change codeChange) String() string {
+	fields := make([]string, 0, len(change.fields))
+	for _, field := range change.fields {
+		fields = append(fields, fmt.Sprintf("%s: %q -> %q", field.field, field.old, field.new))
+	}
+	return change.senderCode + ": " + strings.Join(fields, ", ")
+}
+
+type codelistPlan struct {
+	name      string
+	strategy  string
+	versions  []string
+	added     []codelistItem
+	removed   []codelistItem
+	changed   []codeChange
+	unchanged int
+	errors    []string
+}
+
+func itemFromCode(code b2bapi.Code) codelistItem {
+	item := codelistItem{active: actionYes, senderCode: code.SenderCode, receiverCode: code.ReceiverCode, description: code.Description}
+	item.text = [10]string{code.Text1, code.Text2, code.Text3, code.Text4, code.Text5, code.Text6, code.Text7, code.Text8, code.Text9}
+	return item
+}
+
+// values returns the fields of the item in the order of codeFieldNames.
+func (item codelistItem) values() []string {
+	values := []string{item.receiverCode, item.description}
+	return append(values, item.text[:9]...)
+}
+
+// sheetNames returns the sheet names of the workbook in workbook order.
+func sheetNames(f *excelize.File) []string {
+	sheets := f.GetSheetMap()
+	indexes := make([]int, 0, len(sheets))
+	for index := range sheets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	names := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		names = append(names, sheets[index])
+	}
+	return names
+}
+
+// diffCodes compares the codes of the live code list with the wanted codes
+// using the sender code as the key.
+func diffCodes(name string, live []codelistItem, wanted []codelistItem) *codelistPlan {
+	plan := &codelistPlan{name: name}
+	current := make(map[string]codelistItem)
+	for _, item := range live {
+		current[item.senderCode] = item
+	}
+	seen := make(map[string]bool)
+	for _, item := range wanted {
+		seen[item.senderCode] = true
+		old, ok := current[item.senderCode]
+		if !ok {
+			plan.added = append(plan.added, item)
+			continue
+		}
+		change := codeChange{senderCode: item.senderCode, item: item}
+		oldValues := old.values()
+		for i, value := range item.values() {
+			if value != oldValues[i] {
+				change.fields = append(change.fields, fieldChange{field: codeFieldNames[i], old: oldValues[i], new: value})
+			}
+		}
+		if len(change.fields) > 0 {
+			plan.changed = append(plan.changed, change)
+		} else {
+			plan.unchanged++
+		}
+	}
+	for _, item := range live {
+		if !seen[item.senderCode] {
+			plan.removed = append(plan.removed, item)
+		}
+	}
+	sort.Slice(plan.added, func(i, j int) bool { return plan.added[i].senderCode < plan.added[j].senderCode })
+	sort.Slice(plan.removed, func(i, j int) bool { return plan.removed[i].senderCode < plan.removed[j].senderCode })
+	sort.Slice(plan.changed, func(i, j int) bool { return plan.changed[i].senderCode < plan.changed[j].senderCode })
+	return plan
+}
+
+func (plan *codelistPlan) hasChanges() bool {
+	return len(plan.added) > 0 || len(plan.removed) > 0 || len(plan.changed) > 0
+}
+
+func (plan *codelistPlan) print() {
+	if len(plan.versions) == 0 {
+		fmt.Printf("Code List \"%s\": will be created\n", plan.name)
+	} else if plan.strategy == strategyNewVersion {
+		fmt.Printf("Code List \"%s\": a new version will be created, keeping version(s) %s\n", plan.name, strings.Join(plan.versions, ", "))
+	} else if plan.strategy == strategyMerge {
+		fmt.Printf("Code List \"%s\": will be merged into %s\n", plan.name, plan.versions[0])
+	} else {
+		fmt.Printf("Code List \"%s\": will be recreated, deleting version(s) %s\n", plan.name, strings.Join(plan.versions, ", "))
+	}
+	plan.printChanges()
+}
+
+// printChanges prints the codes to add, remove and change.
+func (plan *codelistPlan) printChanges() {
+	for _, item := range plan.added {
+		fmt.Printf("  + %s -> %s\n", item.senderCode, item.receiverCode)
+	}
+	for _, item := range plan.removed {
+		fmt.Printf("  - %s -> %s\n", item.senderCode, item.receiverCode)
+	}
+	for _, change := range plan.changed {
+		fmt.Printf("  ~ %s\n", change)
+	}
+	fmt.Printf("  %d to add, %d to remove, %d to change, %d unchanged\n", len(plan.added), len(plan.removed), len(plan.changed), plan.unchanged)
+	for _, errormsg := range plan.errors {
+		fmt.Printf("  %s\n", errormsg)
+	}
+}
+
+// runPlan reports what runUpdate would change for every code list in the
+// input document without making any change on B2Bi.
+func (mgr *apiMgr) runPlan() error {
+	fmt.Println("Planning Sterling B2B Integrator \"Code List\" changes using \"" + mgr.username + "\" account and \"" + mgr.infile + "\" (no changes will be made)")
+	fmt.Println("Update strategy: " + mgr.strategy)
+	lists, err := readInput(mgr.infile, mgr.format)
+	if err != nil {
+		mgr.addError("ERROR - Invalid input file [" + mgr.infile + "] " + err.Error())
+		return err
+	}
+
+	planned := 0
+	changed := 0
+	for _, list := range lists {
+		mgr.codelist = list.name
+		items, codelistErrors := readCodelistRows(mgr.codelist, list.rows, mgr.listColumns(mgr.codelist), list.workbook)
+		live, versions, err := mgr.fetchLiveItems()
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + mgr.codelist + "\" " + err.Error())
+			continue
+		}
+		if mgr.strategy == strategyMerge {
+			var mergeErrors []string
+			items, mergeErrors = mergeCodes(live, items)
+			codelistErrors = append(codelistErrors, mergeErrors...)
+		} else {
+			var loadErrors []string
+			items, loadErrors = wantedItems(live, items)
+			codelistErrors = append(codelistErrors, loadErrors...)
+		}
+		plan := diffCodes(mgr.codelist, live, items)
+		plan.versions = versions
+		plan.strategy = mgr.strategy
+		plan.errors = codelistErrors
+		plan.print()
+		planned++
+		if plan.hasChanges() || len(versions) == 0 {
+			changed++
+		}
+	}
+	if planned == 0 && len(mgr.errorsList) == 0 {
+		mgr.addError("ERROR: invalid input document or CodeList(s) not found")
+		mgr.showErrors("")
+		os.Exit(20002)
+	}
+	fmt.Printf("%d Code List(s) checked, %d with changes.\n", planned, changed)
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Failed to read Code List(s)")
+	}
+	return nil
+}
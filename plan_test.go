@@ -0,0 +1,88 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"strings"
+	"testing"
+)
+
+// planString returns the changes of a plan as "+added -removed ~change",
+// followed by an = for every unchanged code.
+func planString(plan *codelistPlan) string {
+	changes := make([]string, 0)
+	for _, item := range plan.added {
+		changes = append(changes, "+"+item.senderCode)
+	}
+	for _, item := range plan.removed {
+		changes = append(changes, "-"+item.senderCode)
+	}
+	for _, change := range plan.changed {
+		changes = append(changes, "~"+change.String())
+	}
+	if plan.unchanged > 0 {
+		changes = append(changes, strings.Repeat("=", plan.unchanged))
+	}
+	return strings.Join(changes, " ")
+}
+
+func TestDiffCodes(t *testing.T) {
+	code := func(senderCode, receiverCode, description, text1, text9 string) b2bapi.Code {
+		return b2bapi.Code{SenderCode: senderCode, ReceiverCode: receiverCode, Description: description, Text1: text1, Text9: text9}
+	}
+	live := []b2bapi.Code{code("A", "RA", "a", "1", ""), code("B", "RB", "", "", "")}
+	tests := []struct {
+		name   string
+		wanted []b2bapi.Code
+		want   string
+	}{
+		{"unchanged", []b2bapi.Code{code("B", "RB", "", "", ""), code("A", "RA", "a", "1", "")}, "=="},
+		{"added", append(append([]b2bapi.Code{}, live...), code("D", "RD", "", "", ""), code("C", "RC", "", "", "")), "+C +D =="},
+		{"removed", live[1:], "-A ="},
+		{"sender code", []b2bapi.Code{code("X", "RA", "a", "1", ""), live[1]}, "+X -A ="},
+		{"receiver code", []b2bapi.Code{code("A", "RX", "a", "1", ""), live[1]}, "~A: receiverCode: \"RA\" -> \"RX\" ="},
+		{"description", []b2bapi.Code{code("A", "RA", "", "1", ""), live[1]}, "~A: description: \"a\" -> \"\" ="},
+		{"texts", []b2bapi.Code{code("A", "RA", "a", "2", "9"), live[1]}, "~A: text1: \"1\" -> \"2\", text9: \"\" -> \"9\" ="},
+		{"every code", []b2bapi.Code{code("B", "RX", "b", "", "")}, "-A ~B: receiverCode: \"RB\" -> \"RX\", description: \"\" -> \"b\""},
+		{"empty", nil, "-A -B"},
+	}
+	for _, test := range tests {
+		plan := diffCodes("LIST", liveItems([]b2bapi.CodeList{{Codes: live}}), liveItems([]b2bapi.CodeList{{Codes: test.wanted}}))
+		if got := planString(plan); got != test.want {
+			t.Errorf("%s: plan %q, want %q", test.name, got, test.want)
+		}
+		if plan.hasChanges() != (test.name != "unchanged") {
+			t.Errorf("%s: hasChanges = %v", test.name, plan.hasChanges())
+		}
+	}
+}
+
+func TestRunPlanReadOnly(t *testing.T) {
+	for _, strategy := range []string{strategyReplace, strategyNewVersion, strategyMerge} {
+		dir := t.TempDir()
+		fake, client := newFakeB2Bi(t)
+		fake.put("LIST", 1, 0, "A")
+		fake.put("LIST", 2, 1, "A", "B")
+		fake.put("SAME", 1, 1, "S")
+		mgr := newJournalMgr(client, dir, strategy)
+		mgr.infile = writeInput(t, dir, map[string]string{"LIST": "A,RX\nC,RC\n", "NEW": "N,RN\n", "SAME": "S,RS\n"})
+		var err error
+		output := captureOutput(t, func() { err = mgr.runPlan() })
+		if err != nil {
+			t.Errorf("%s: runPlan: %v %v", strategy, err, mgr.errorsList)
+			continue
+		}
+		for method, count := range fake.requests {
+			if method != "GET" && method != "HEAD" && count > 0 {
+				t.Errorf("%s: runPlan sent %d %s requests", strategy, count, method)
+			}
+		}
+		for _, want := range []string{"Code List \"NEW\": will be created", "  + C -> RC\n", "  ~ A: receiverCode: \"RA\" -> \"RX\"\n", "3 Code List(s) checked, 2 with changes."} {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s: output has no %q:\n%s", strategy, want, output)
+			}
+		}
+		if versions := fake.versions("LIST"); len(versions) != 2 || versionCodes(versions[1]) != "A,B" || len(fake.versions("NEW")) != 0 {
+			t.Errorf("%s: plan changed LIST to %+v", strategy, versions)
+		}
+	}
+}
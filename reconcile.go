@@ -0,0 +1,257 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"encoding/csv"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// listFile is the YAML layout of a code list file of a reconcile directory.
+type listFile struct {
+	CodeListName string     `yaml:"codeListName"`
+	Codes        []codeFile `yaml:"codes"`
+}
+
+type codeFile struct {
+	SenderCode   string `yaml:"senderCode"`
+	ReceiverCode string `yaml:"receiverCode"`
+	Description  string `yaml:"description,omitempty"`
+	Text1        string `yaml:"text1,omitempty"`
+	Text2        string `yaml:"text2,omitempty"`
+	Text3        string `yaml:"text3,omitempty"`
+	Text4        string `yaml:"text4,omitempty"`
+	Text5        string `yaml:"text5,omitempty"`
+	Text6        string `yaml:"text6,omitempty"`
+	Text7        string `yaml:"text7,omitempty"`
+	Text8        string `yaml:"text8,omitempty"`
+	Text9        string `yaml:"text9,omitempty"`
+}
+
+// runReconcile makes the code lists on B2Bi match the files of a directory,
+// one file per code list. Only the code lists whose codes differ are backed
+// up and updated, the code lists on B2Bi without a file are reported.
+func (mgr *apiMgr) runReconcile(dir string, patterns []string, planOnly bool) error {
+	if planOnly {
+		fmt.Println("Planning Sterling B2B Integrator \"Code List\" changes using \"" + mgr.username + "\" account and \"" + dir + "\" (no changes will be made)")
+	} else {
+		fmt.Println("Sterling B2B Integrator \"Code Lists\" are being reconciled using \"" + mgr.username + "\" account and \"" + dir + "\"")
+	}
+	lists, err := readDirInput(dir)
+	if err != nil {
+		mgr.addError("ERROR - Invalid directory [" + dir + "] " + err.Error())
+		return err
+	}
+	wanted := make(map[string]inputList)
+	names := make([]string, 0, len(lists))
+	for _, list := range lists {
+		if _, ok := wanted[list.name]; ok {
+			mgr.addError("ERROR: Code List \"" + list.name + "\" is found in more than one file")
+			continue
+		}
+		wanted[list.name] = list
+		names = append(names, list.name)
+	}
+	sort.Strings(names)
+	names, unmatched := matchNames(names, patterns)
+	for _, pattern := range unmatched {
+		mgr.addError("ERROR: no Code List file found for \"" + pattern + "\"")
+	}
+
+	if !mgr.checkSchemas(names) {
+		return fmt.Errorf("Invalid schema, no Code List reconciled")
+	}
+
+	// the code lists to change are all backed up and the backup file saved
+	// before the first update
+	type pendingList struct {
+		name   string
+		items  []codelistItem
+		exists bool
+	}
+	pending := make([]pendingList, 0, len(names))
+	for _, name := range names {
+		mgr.codelist = name
+		items, codelistErrors := readCodelistRows(name, wanted[name].rows, mgr.listColumns(name), wanted[name].workbook)
+		live, versions, err := mgr.fetchLiveItems()
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		items, loadErrors := loadedItems(live, items)
+		codelistErrors = append(codelistErrors, loadErrors...)
+		if len(codelistErrors) > 0 {
+			for _, errormsg := range codelistErrors {
+				mgr.addError(name + ": " + errormsg)
+			}
+			fmt.Printf("Code List \"%s\": not reconciled, the file has errors\n", name)
+			continue
+		}
+		plan := diffCodes(name, live, items)
+		if len(versions) > 0 && !plan.hasChanges() {
+			fmt.Printf("Code List \"%s\": unchanged (%d code(s))\n", name, plan.unchanged)
+			continue
+		}
+		if len(versions) == 0 {
+			fmt.Printf("Code List \"%s\": will be created\n", name)
+		} else {
+			fmt.Printf("Code List \"%s\": will be updated\n", name)
+		}
+		plan.printChanges()
+		pending = append(pending, pendingList{name: name, items: items, exists: len(versions) > 0})
+	}
+
+	changed := 0
+	if planOnly {
+		changed = len(pending)
+		pending = nil
+	}
+	backedUp := make([]pendingList, 0, len(pending))
+	saveBackup := false
+	for _, list := range pending {
+		if list.exists {
+			mgr.codelist = list.name
+			err = mgr.backupCodelist()
+			if err != nil {
+				mgr.addError("ERROR: unable to back up Code List \"" + list.name + "\", not updated " + err.Error())
+				continue
+			}
+			saveBackup = true
+		}
+		backedUp = append(backedUp, list)
+	}
+	if saveBackup {
+		mgr.bkpfileptr.DeleteSheet("Sheet1")
+		err = mgr.bkpfileptr.SaveAs(mgr.bkpdir + "/" + mgr.bkpfile)
+		if err != nil {
+			mgr.addError("ERROR: unable to write the backup file " + mgr.bkpfile + ", no Code List updated")
+			return err
+		}
+		fmt.Println("A backup file \"" + mgr.bkpfile + "\" has been created.")
+	}
+	for _, list := range backedUp {
+		mgr.codelist = list.name
+		err = mgr.updateCodelist(list.items)
+		if err != nil {
+			mgr.addError("ERROR: Code List \"" + list.name + "\" not updated " + err.Error())
+			continue
+		}
+		changed++
+	}
+
+	codelists, err := mgr.listCodelists()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+	} else {
+		unmanaged, _ := matchNames(store.Names(codelists), patterns)
+		for _, name := range unmanaged {
+			if _, ok := wanted[name]; !ok {
+				fmt.Printf("Code List \"%s\": no file in %s, left unchanged\n", name, dir)
+			}
+		}
+	}
+
+	if planOnly {
+		fmt.Printf("%d Code List(s) checked, %d with changes.\n", len(names), changed)
+	} else {
+		fmt.Printf("%d Code List(s) checked, %d updated.\n", len(names), changed)
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Reconcile failed")
+	}
+	return nil
+}
+
+// runPull writes the active version of the code lists matching the patterns
+// into a directory, one csv or yaml file per code list with the codes in
+// sender code order.
+func (mgr *apiMgr) runPull(dir, fileFormat string, patterns []string) error {
+	codelists, err := mgr.listCodelists()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+		return err
+	}
+	names, unmatched := matchNames(store.Names(codelists), patterns)
+	for _, pattern := range unmatched {
+		mgr.addError("ERROR: no Code List found for \"" + pattern + "\"")
+	}
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		mgr.addError("ERROR: unable to create " + dir + " " + err.Error())
+		return err
+	}
+	written := 0
+	for _, name := range names {
+		mgr.codelist = name
+		versions, err := mgr.fetchCodelists()
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		codelist, err := store.ResolveVersion(name, versions)
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\" " + err.Error())
+			continue
+		}
+		codes := append([]b2bapi.Code{}, codelist.Codes...)
+		sort.SliceStable(codes, func(i, j int) bool { return codes[i].SenderCode < codes[j].SenderCode })
+		file := filepath.Join(dir, url.PathEscape(name)+"."+fileFormat)
+		if fileFormat == "yaml" {
+			err = writeListYAML(file, name, codes)
+		} else {
+			schema, schemaErrors := loadSchema(mgr.config, name)
+			for _, errormsg := range schemaErrors {
+				mgr.addError(errormsg)
+			}
+			err = writeListCSV(file, schema.header("")[1:], codes)
+		}
+		if err != nil {
+			mgr.addError("ERROR: unable to write " + file + " " + err.Error())
+			continue
+		}
+		fmt.Printf("%s written (version %d, %d code(s)).\n", file, codelist.VersionNumber, len(codes))
+		written++
+	}
+	fmt.Printf("%d Code List(s) written to \"%s\".\n", written, dir)
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Pull failed")
+	}
+	return nil
+}
+
+func writeListCSV(file string, header []string, codes []b2bapi.Code) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(header)
+	for _, code := range codes {
+		item := itemFromCode(code)
+		w.Write(append([]string{item.senderCode}, item.values()...))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeListYAML(file, name string, codes []b2bapi.Code) error {
+	document := listFile{CodeListName: name, Codes: make([]codeFile, 0, len(codes))}
+	for _, code := range codes {
+		document.Codes = append(document.Codes, codeFile(code))
+	}
+	data, err := yaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureOutput returns what run prints on the standard output.
+func captureOutput(t *testing.T, run func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- string(data)
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	run()
+	w.Close()
+	return <-output
+}
+
+func TestRunReconcile(t *testing.T) {
+	dir := t.TempDir()
+	fake, client := newFakeB2Bi(t)
+	fake.put("FAIL", 1, 1, "A")
+	fake.put("SAME", 1, 0, "X")
+	fake.put("SAME", 2, 1, "A", "B")
+	fake.put("UPD", 1, 1, "A")
+	fake.put("OTHER", 1, 1, "O")
+	mgr := newJournalMgr(client, dir, "")
+	input := writeInput(t, dir, map[string]string{
+		"FAIL": "A,RA\nB,RB\n",
+		"NEW":  "N,RN\n",
+		"SAME": "A,RA\nB,RB\n",
+		"UPD":  "A,RA\nC,RC\n",
+	})
+
+	// FAIL is the first code list updated, its update fails
+	fake.failUpdate = 1
+	backupSaved := false
+	fake.before = func(r *http.Request) {
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/bulkupdatecodes") && !backupSaved {
+			backupSaved = fileExists(filepath.Join(mgr.bkpdir, mgr.bkpfile))
+			if !backupSaved {
+				t.Errorf("%s sent before the backup file was saved", r.URL.Path)
+			}
+		}
+	}
+	var err error
+	output := captureOutput(t, func() { err = mgr.runReconcile(input, nil, false) })
+	if err == nil || len(mgr.errorsList) != 1 || !strings.Contains(mgr.errorsList[0], "Code List \"FAIL\" not updated") {
+		t.Fatalf("runReconcile returned %v, errors %v", err, mgr.errorsList)
+	}
+	for _, want := range []string{
+		"Code List \"FAIL\": will be updated",
+		"Code List \"NEW\": will be created",
+		"Code List \"SAME\": unchanged (2 code(s))",
+		"Code List \"UPD\": will be updated",
+		"Code List \"OTHER\": no file in " + input + ", left unchanged",
+		"4 Code List(s) checked, 2 updated.",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output has no %q:\n%s", want, output)
+		}
+	}
+
+	lists := map[string]string{"FAIL": "A", "NEW": "N", "SAME": "A,B", "UPD": "A,C", "OTHER": "O"}
+	for name, want := range lists {
+		versions := fake.versions(name)
+		if got := versionCodes(versions[len(versions)-1]); got != want {
+			t.Errorf("%s left with %s, want %s", name, got, want)
+		}
+	}
+	if versions := fake.versions("SAME"); len(versions) != 2 || versions[1].ListStatus != 1 {
+		t.Errorf("unchanged SAME left as %+v", versions)
+	}
+	for name, applied := range map[string]bool{"FAIL": false, "NEW": true, "SAME": false, "UPD": true} {
+		if fileExists(mgr.stateFile(name)) != applied {
+			t.Errorf("state of %s recorded %v, want %v", name, !applied, applied)
+		}
+	}
+
+	f, err := excelize.OpenFile(filepath.Join(mgr.bkpdir, mgr.bkpfile))
+	if err != nil {
+		t.Fatalf("backup file: %v", err)
+	}
+	sheets, sheetErrors := readBackupSheets(f)
+	backedUp := make([]string, 0, len(sheets))
+	for _, sheet := range sheets {
+		backedUp = append(backedUp, sheet.id)
+	}
+	if strings.Join(backedUp, " ") != "FAIL|||1 UPD|||1" || len(sheetErrors) > 0 {
+		t.Errorf("backup of %v (%v), want FAIL|||1 UPD|||1", backedUp, sheetErrors)
+	}
+
+	// the plan of the same directory only shows the change left
+	posts := fake.requests["POST"]
+	mgr = newJournalMgr(client, dir, "")
+	output = captureOutput(t, func() { err = mgr.runReconcile(input, nil, true) })
+	if err != nil || fake.requests["POST"] != posts || !strings.Contains(output, "4 Code List(s) checked, 1 with changes.") {
+		t.Errorf("plan returned %v, sent %d POST requests:\n%s", err, fake.requests["POST"]-posts, output)
+	}
+}
+
+func TestRunPull(t *testing.T) {
+	fake, client := newFakeB2Bi(t)
+	fake.put("A LIST", 1, 0, "X")
+	fake.put("A LIST", 2, 1, "C", "01", "1.50", "B")
+	fake.put("OTHER", 1, 1, "O")
+	header := "SenderCode,ReceiverCode,Description,Text1,Text2,Text3,Text4,Text5,Text6,Text7,Text8,Text9\n"
+	tests := []struct {
+		fileFormat string
+		file       string
+		want       []string
+	}{
+		{"csv", "A%20LIST.csv", []string{header + "01,R01,,,,,,,,,,\n1.50,R1.50,,,,,,,,,,\nB,RB,,,,,,,,,,\nC,RC,,,,,,,,,,\n"}},
+		{"yaml", "A%20LIST.yaml", []string{"codeListName: A LIST\n", "- senderCode: \"01\"\n", "- senderCode: \"1.50\"\n", "- senderCode: B\n", "- senderCode: C\n"}},
+	}
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "lists")
+		mgr := newJournalMgr(client, t.TempDir(), "")
+		var err error
+		captureOutput(t, func() { err = mgr.runPull(dir, test.fileFormat, []string{"A*"}) })
+		if err != nil {
+			t.Fatalf("%s: runPull: %v %v", test.fileFormat, err, mgr.errorsList)
+		}
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 1 || files[0].Name() != test.file {
+			t.Errorf("%s: pull wrote %v, want %s", test.fileFormat, files, test.file)
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := -1
+		for _, want := range test.want {
+			at := strings.Index(string(data), want)
+			if at <= last {
+				t.Errorf("%s: %q missing or out of order in\n%s", test.fileFormat, want, data)
+			}
+			last = at
+		}
+
+		// the pulled files are the state of B2Bi
+		requests := fake.requests["POST"] + fake.requests["PUT"] + fake.requests["DELETE"]
+		mgr = newJournalMgr(client, t.TempDir(), "")
+		output := captureOutput(t, func() { err = mgr.runReconcile(dir, []string{"A*"}, false) })
+		if err != nil || !strings.Contains(output, "Code List \"A LIST\": unchanged (4 code(s))") || !strings.Contains(output, "1 Code List(s) checked, 0 updated.") {
+			t.Errorf("%s: reconcile of the pulled files returned %v %v:\n%s", test.fileFormat, err, mgr.errorsList, output)
+		}
+		if changes := fake.requests["POST"] + fake.requests["PUT"] + fake.requests["DELETE"] - requests; changes != 0 {
+			t.Errorf("%s: reconcile of the pulled files sent %d changes", test.fileFormat, changes)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"encoding/xml"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resourceNamespace is the namespace of the resource manager import/export
+// documents of B2Bi.
+const resourceNamespace = "http://www.stercomm.com/SI/SI_IE_Resources"
+
+// resourceDateFormats are the layouts of CREATE_DATE in the resource manager
+// documents.
+var resourceDateFormats = []string{"2006-01-02 15:04:05.0", "2006-01-02 15:04:05", b2bapi.TimeFormat, time.RFC3339}
+
+// siResources is the root of a resource manager export, only the code
+// lists are read and written.
+type siResources struct {
+	XMLName   xml.Name           `xml:"SI_RESOURCES"`
+	Xmlns     string             `xml:"xmlns,attr,omitempty"`
+	CodeLists []resourceCodeList `xml:"CODE_LISTS>CODE_LIST_XREF"`
+}
+
+type resourceCodeList struct {
+	ListName    string             `xml:"LIST_NAME"`
+	SenderID    string             `xml:"SENDER_ID"`
+	ReceiverID  string             `xml:"RECEIVER_ID"`
+	ListVersion int                `xml:"LIST_VERSION"`
+	Status      int                `xml:"STATUS"`
+	Comments    string             `xml:"COMMENTS"`
+	Username    string             `xml:"USERNAME"`
+	CreateDate  string             `xml:"CREATE_DATE"`
+	Items       []resourceCodeItem `xml:"CODE_LIST_XREF_ITEMS>CODE_LIST_XREF_ITEM"`
+}
+
+type resourceCodeItem struct {
+	SenderItem   string `xml:"SENDER_ITEM"`
+	ReceiverItem string `xml:"RECEIVER_ITEM"`
+	Description  string `xml:"DESCRIPTION"`
+	Text1        string `xml:"TEXT1"`
+	Text2        string `xml:"TEXT2"`
+	Text3        string `xml:"TEXT3"`
+	Text4        string `xml:"TEXT4"`
+	Text5        string `xml:"TEXT5"`
+	Text6        string `xml:"TEXT6"`
+	Text7        string `xml:"TEXT7"`
+	Text8        string `xml:"TEXT8"`
+	Text9        string `xml:"TEXT9"`
+}
+
+func (codelist resourceCodeList) apiCodeList() b2bapi.CodeList {
+	converted := b2bapi.CodeList{
+		ID:            codelist.ListName + "|||" + strconv.Itoa(codelist.ListVersion),
+		CodeListName:  codelist.ListName,
+		VersionNumber: codelist.ListVersion,
+		UserName:      codelist.Username,
+		ListStatus:    codelist.Status,
+		Codes:         make([]b2bapi.Code, 0, len(codelist.Items)),
+	}
+	for _, layout := range resourceDateFormats {
+		if created, err := time.Parse(layout, strings.TrimSpace(codelist.CreateDate)); err == nil {
+			converted.CreateDate = b2bapi.Timestamp{Time: created}
+			break
+		}
+	}
+	for _, item := range codelist.Items {
+		converted.Codes = append(converted.Codes, b2bapi.Code{
+			SenderCode:   item.SenderItem,
+			ReceiverCode: item.ReceiverItem,
+			Description:  item.Description,
+			Text1:        item.Text1,
+			Text2:        item.Text2,
+			Text3:        item.Text3,
+			Text4:        item.Text4,
+			Text5:        item.Text5,
+			Text6:        item.Text6,
+			Text7:        item.Text7,
+			Text8:        item.Text8,
+			Text9:        item.Text9,
+		})
+	}
+	return converted
+}
+
+func resourceFromCodeList(codelist b2bapi.CodeList) resourceCodeList {
+	converted := resourceCodeList{
+		ListName:    codelist.CodeListName,
+		ListVersion: codelist.VersionNumber,
+		Status:      codelist.ListStatus,
+		Username:    codelist.UserName,
+		Items:       make([]resourceCodeItem, 0, len(codelist.Codes)),
+	}
+	if !codelist.CreateDate.IsZero() {
+		converted.CreateDate = codelist.CreateDate.Format(resourceDateFormats[0])
+	}
+	for _, code := range codelist.Codes {
+		converted.Items = append(converted.Items, resourceCodeItem{
+			SenderItem:   code.SenderCode,
+			ReceiverItem: code.ReceiverCode,
+			Description:  code.Description,
+			Text1:        code.Text1,
+			Text2:        code.Text2,
+			Text3:        code.Text3,
+			Text4:        code.Text4,
+			Text5:        code.Text5,
+			Text6:        code.Text6,
+			Text7:        code.Text7,
+			Text8:        code.Text8,
+			Text9:        code.Text9,
+		})
+	}
+	return converted
+}
+
+// readResourceXML returns every version of the code lists of a resource
+// manager export.
+func readResourceXML(path string) ([]b2bapi.CodeList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var resources siResources
+	err = xml.Unmarshal(data, &resources)
+	if err != nil {
+		return nil, err
+	}
+	codelists := make([]b2bapi.CodeList, 0, len(resources.CodeLists))
+	for _, codelist := range resources.CodeLists {
+		codelists = append(codelists, codelist.apiCodeList())
+	}
+	return codelists, nil
+}
+
+// readXMLInput reads the code lists of a resource manager export, the
+// active version of a code list (or its highest version) is the one read.
+func readXMLInput(path string) ([]inputList, error) {
+	codelists, err := readResourceXML(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	versions := make(map[string][]b2bapi.CodeList)
+	for _, codelist := range codelists {
+		if _, ok := versions[codelist.CodeListName]; !ok {
+			names = append(names, codelist.CodeListName)
+		}
+		versions[codelist.CodeListName] = append(versions[codelist.CodeListName], codelist)
+	}
+	selected := make([]b2bapi.CodeList, 0, len(names))
+	for _, name := range names {
+		codelist, err := store.ResolveVersion(name, versions[name])
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, *codelist)
+	}
+	return codelistInputs(selected)
+}
+
+// writeResourceXML writes the code lists as a resource manager export that
+// can be imported into B2Bi.
+func writeResourceXML(path string, codelists []b2bapi.CodeList) error {
+	resources := siResources{Xmlns: resourceNamespace}
+	for _, codelist := range codelists {
+		resources.CodeLists = append(resources.CodeLists, resourceFromCodeList(codelist))
+	}
+	data, err := xml.MarshalIndent(resources, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
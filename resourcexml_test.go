@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// resourceExport is a resource manager export with an AMF_XREF_ code list
+// of two versions and XML escaped values.
+const resourceExport = `<?xml version="1.0" encoding="UTF-8"?>
+<SI_RESOURCES xmlns="http://www.stercomm.com/SI/SI_IE_Resources">
+  <CODE_LISTS>
+    <CODE_LIST_XREF>
+      <LIST_NAME>AMF_XREF_SAP_UOM</LIST_NAME>
+      <SENDER_ID></SENDER_ID>
+      <RECEIVER_ID></RECEIVER_ID>
+      <LIST_VERSION>1</LIST_VERSION>
+      <STATUS>0</STATUS>
+      <COMMENTS></COMMENTS>
+      <USERNAME>admin</USERNAME>
+      <CREATE_DATE>2022-03-01 10:10:10.0</CREATE_DATE>
+      <CODE_LIST_XREF_ITEMS>
+        <CODE_LIST_XREF_ITEM>
+          <SENDER_ITEM>EA</SENDER_ITEM>
+          <RECEIVER_ITEM>EACH</RECEIVER_ITEM>
+          <DESCRIPTION>old</DESCRIPTION>
+        </CODE_LIST_XREF_ITEM>
+      </CODE_LIST_XREF_ITEMS>
+    </CODE_LIST_XREF>
+    <CODE_LIST_XREF>
+      <LIST_NAME>AMF_XREF_SAP_UOM</LIST_NAME>
+      <SENDER_ID></SENDER_ID>
+      <RECEIVER_ID></RECEIVER_ID>
+      <LIST_VERSION>2</LIST_VERSION>
+      <STATUS>1</STATUS>
+      <COMMENTS></COMMENTS>
+      <USERNAME>apiuser</USERNAME>
+      <CREATE_DATE>2022-03-02 11:11:11.0</CREATE_DATE>
+      <CODE_LIST_XREF_ITEMS>
+        <CODE_LIST_XREF_ITEM>
+          <SENDER_ITEM>R&amp;D</SENDER_ITEM>
+          <RECEIVER_ITEM>&lt;PK&gt;</RECEIVER_ITEM>
+          <DESCRIPTION>&quot;pack&quot; &amp; &apos;box&apos;</DESCRIPTION>
+          <TEXT1>1.5</TEXT1>
+          <TEXT9>Ünïcødé</TEXT9>
+        </CODE_LIST_XREF_ITEM>
+        <CODE_LIST_XREF_ITEM>
+          <SENDER_ITEM>PL</SENDER_ITEM>
+          <RECEIVER_ITEM>PALLET</RECEIVER_ITEM>
+          <DESCRIPTION></DESCRIPTION>
+        </CODE_LIST_XREF_ITEM>
+      </CODE_LIST_XREF_ITEMS>
+    </CODE_LIST_XREF>
+  </CODE_LISTS>
+</SI_RESOURCES>
+`
+
+func TestResourceXMLRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export.xml")
+	if err := ioutil.WriteFile(path, []byte(resourceExport), 0644); err != nil {
+		t.Fatal(err)
+	}
+	codelists, err := readResourceXML(path)
+	if err != nil {
+		t.Fatalf("readResourceXML: %v", err)
+	}
+	if len(codelists) != 2 {
+		t.Fatalf("read %d code lists, want 2", len(codelists))
+	}
+	active := codelists[1]
+	if active.ID != "AMF_XREF_SAP_UOM|||2" || active.ListStatus != 1 || active.UserName != "apiuser" || active.CreateDate.Format("2006-01-02 15:04:05") != "2022-03-02 11:11:11" {
+		t.Errorf("version 2 read as %+v", active)
+	}
+	code := active.Codes[0]
+	if code.SenderCode != "R&D" || code.ReceiverCode != "<PK>" || code.Description != `"pack" & 'box'` || code.Text1 != "1.5" || code.Text9 != "Ünïcødé" {
+		t.Errorf("escaped code read as %+v", code)
+	}
+
+	written := filepath.Join(dir, "written.xml")
+	if err := writeResourceXML(written, codelists); err != nil {
+		t.Fatalf("writeResourceXML: %v", err)
+	}
+	data, err := ioutil.ReadFile(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`xmlns="http://www.stercomm.com/SI/SI_IE_Resources"`, "<SENDER_ITEM>R&amp;D</SENDER_ITEM>", "<RECEIVER_ITEM>&lt;PK&gt;</RECEIVER_ITEM>", "<CREATE_DATE>2022-03-02 11:11:11.0</CREATE_DATE>"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("written document has no %s:\n%s", want, data)
+		}
+	}
+	again, err := readResourceXML(written)
+	if err != nil {
+		t.Fatalf("readResourceXML of the written document: %v", err)
+	}
+	if !reflect.DeepEqual(again, codelists) {
+		t.Errorf("round trip changed the code lists:\n%+v\nwant\n%+v", again, codelists)
+	}
+
+	lists, err := readXMLInput(written)
+	if err != nil {
+		t.Fatalf("readXMLInput: %v", err)
+	}
+	if len(lists) != 1 || lists[0].name != "AMF_XREF_SAP_UOM" || len(lists[0].rows) != 3 || lists[0].rows[1][1] != "R&D" {
+		t.Errorf("readXMLInput returned %+v, want the 2 codes of version 2", lists)
+	}
+}
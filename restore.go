@@ -0,0 +1,215 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// backupSheet is a version saved in a backup file, the codes are in sheet.
+type backupSheet struct {
+	sheet   string
+	id      string
+	name    string
+	version int
+	status  int
+}
+
+// parseCodelistID splits a code list _id (Name|||version) into the code list
+// name and version number.
+func parseCodelistID(id string) (string, int, error) {
+	pos := strings.LastIndex(id, "|||")
+	if pos <= 0 {
+		return "", 0, fmt.Errorf("invalid Code List id \"%s\"", id)
+	}
+	version, err := strconv.Atoi(id[pos+3:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid Code List version in \"%s\"", id)
+	}
+	return id[:pos], version, nil
+}
+
+// readBackupSheets returns the versions saved in a backup file. The sheets
+// are named after the _id in backup files written before the Versions sheet
+// had a Sheet column.
+func readBackupSheets(f *excelize.File) ([]backupSheet, []string) {
+	if f.GetSheetIndex(backupVersionsSheet) == 0 {
+		ids := make([][]string, 0)
+		for _, sheet := range sheetNames(f) {
+			if sheet != "Sheet1" {
+				ids = append(ids, []string{sheet})
+			}
+		}
+		return backupSheets(ids)
+	}
+	rows := f.GetRows(backupVersionsSheet)
+	if len(rows) > 0 {
+		rows = rows[1:]
+	}
+	return backupSheets(rows)
+}
+
+// backupSheets reads the rows of a Versions sheet, the _id is in the first
+// column, the list status in the third one and the sheet in the sixth one.
+func backupSheets(rows [][]string) ([]backupSheet, []string) {
+	sheets := make([]backupSheet, 0, len(rows))
+	errors := make([]string, 0)
+	for _, row := range rows {
+		if len(row) == 0 || row[0] == "" {
+			continue
+		}
+		name, version, err := parseCodelistID(row[0])
+		if err != nil {
+			errors = append(errors, "ERROR: "+err.Error()+", sheet ignored")
+			continue
+		}
+		sheet := row[0]
+		if len(row) > 5 && row[5] != "" {
+			sheet = row[5]
+		}
+		status := 0
+		if len(row) > 2 {
+			status, _ = strconv.Atoi(row[2])
+		}
+		sheets = append(sheets, backupSheet{sheet: sheet, id: row[0], name: name, version: version, status: status})
+	}
+	return sheets, errors
+}
+
+// runRestore recreates the code lists saved in a backup file created by
+// runUpdate. When selection is not empty only the code lists (or _ids) named
+// in it are restored.
+func (mgr *apiMgr) runRestore(backup string, selection []string) error {
+	fmt.Println("Sterling B2B Integrator \"Code Lists\" are being restored using \"" + mgr.username + "\" account and \"" + backup + "\"")
+	f, err := excelize.OpenFile(backup)
+	if err != nil {
+		return fmt.Errorf("ERROR - Invalid backup file [%s]", backup)
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range selection {
+		selected[name] = true
+	}
+	versions := make(map[string][]backupSheet)
+	names := make([]string, 0)
+	sheets, sheetErrors := readBackupSheets(f)
+	for _, errormsg := range sheetErrors {
+		mgr.addError(errormsg)
+	}
+	for _, sheet := range sheets {
+		if len(selected) > 0 && !selected[sheet.name] && !selected[sheet.id] {
+			continue
+		}
+		if _, ok := versions[sheet.name]; !ok {
+			names = append(names, sheet.name)
+		}
+		versions[sheet.name] = append(versions[sheet.name], sheet)
+	}
+	if len(names) == 0 {
+		mgr.addError("ERROR: no Code List(s) to restore found in " + backup)
+		return fmt.Errorf("Nothing to restore")
+	}
+
+	status, hasStatus := readBackupStatus(f)
+	backedUp := make([]string, 0, len(names))
+	for _, name := range names {
+		mgr.codelist = name
+		err := mgr.backupCodelist()
+		if err != nil {
+			mgr.addError("ERROR: unable to back up Code List \"" + name + "\", not restored " + err.Error())
+			continue
+		}
+		backedUp = append(backedUp, name)
+	}
+	names = backedUp
+	if len(names) == 0 {
+		return fmt.Errorf("Nothing to restore")
+	}
+	mgr.bkpfileptr.DeleteSheet("Sheet1")
+	err = mgr.bkpfileptr.SaveAs(mgr.bkpdir + "/" + mgr.bkpfile)
+	if err != nil {
+		return fmt.Errorf("Failed to create backup file [%s]", mgr.bkpfile)
+	}
+	fmt.Println("A backup file \"" + mgr.bkpfile + "\" has been created.")
+
+	for _, name := range names {
+		mgr.codelist = name
+		live, err := mgr.fetchCodelists()
+		if err != nil {
+			mgr.addError("ERROR: unable to read Code List \"" + name + "\", not restored")
+			continue
+		}
+		deleted := true
+		for _, codelist := range live {
+			if err := mgr.deleteCodelist(codelist.ID); err != nil {
+				mgr.addError("ERROR: unable to delete \"" + codelist.ID + "\", Code List \"" + name + "\" not restored")
+				deleted = false
+				break
+			}
+		}
+		if !deleted {
+			continue
+		}
+		sheets := versions[name]
+		sort.Slice(sheets, func(i, j int) bool { return sheets[i].version < sheets[j].version })
+		active := ""
+		for _, sheet := range sheets {
+			items, codelistErrors := readCodelistRows(sheet.id, f.GetRows(sheet.sheet), mgr.columns, true)
+			for _, errormsg := range codelistErrors {
+				mgr.addError(sheet.id + ": " + errormsg)
+			}
+			err := mgr.CreateCodelist(items, 0)
+			if err != nil {
+				mgr.addError("ERROR: unable to restore \"" + sheet.id + "\" " + err.Error())
+				break
+			}
+			created, err := mgr.latestVersion()
+			if err != nil {
+				mgr.addError("ERROR: unable to read Code List \"" + name + "\" after restoring \"" + sheet.id + "\" " + err.Error())
+				break
+			}
+			fmt.Printf("%s restored from version %d as version %d with %d code(s).\n", name, sheet.version, created.VersionNumber, len(items))
+			if status[sheet.id] == 1 {
+				active = created.ID
+			}
+		}
+		switch {
+		case !hasStatus:
+			fmt.Printf("%s: the backup file has no list status, the active version is chosen by B2Bi.\n", name)
+		case active != "":
+			err := mgr.client.Update(active, b2bapi.UpdateRequest{ListStatus: 1})
+			if err != nil {
+				mgr.addError("ERROR: unable to activate \"" + active + "\" " + err.Error())
+				continue
+			}
+			mgr.recordApplied()
+			fmt.Printf("%s activated.\n", active)
+		}
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Restore failed for some Code List(s)")
+	}
+	return nil
+}
+
+// readBackupStatus returns the list status of the versions saved in a backup
+// file by _id, false when the backup file has no Versions sheet.
+func readBackupStatus(f *excelize.File) (map[string]int, bool) {
+	status := make(map[string]int)
+	if f.GetSheetIndex(backupVersionsSheet) == 0 {
+		return status, false
+	}
+	for i, row := range f.GetRows(backupVersionsSheet) {
+		if i == 0 || len(row) < 3 {
+			continue
+		}
+		listStatus, err := strconv.Atoi(row[2])
+		if err == nil {
+			status[row[0]] = listStatus
+		}
+	}
+	return status, true
+}
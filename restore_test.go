@@ -0,0 +1,68 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupSheets(t *testing.T) {
+	columns, _ := loadColumnAliases(nil)
+	long := "PARTNER_ROUTING_TABLE_FOR_EUROPE_AND_ASIA"
+	codelists := []b2bapi.CodeList{
+		{ID: long + "|||1", CodeListName: long, VersionNumber: 1, Codes: []b2bapi.Code{{SenderCode: "A", ReceiverCode: "RA"}}},
+		{ID: long + "|||12", CodeListName: long, VersionNumber: 12, ListStatus: 1, Codes: []b2bapi.Code{{SenderCode: "B", ReceiverCode: "RB"}}},
+		{ID: "EDI/X12:850|||3", CodeListName: "EDI/X12:850", VersionNumber: 3, Codes: []b2bapi.Code{{SenderCode: "C", ReceiverCode: "RC"}}},
+	}
+	mgr := &apiMgr{columns: columns, bkpfileptr: excelize.NewFile()}
+	for _, codelist := range codelists {
+		mgr.WriteCodeListItem(codelist)
+	}
+	path := filepath.Join(t.TempDir(), "bkp.xlsx")
+	if err := mgr.bkpfileptr.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheets, errors := readBackupSheets(f)
+	if len(errors) > 0 || len(sheets) != len(codelists) {
+		t.Fatalf("readBackupSheets = %v %v, want %d sheets", sheets, errors, len(codelists))
+	}
+	status, _ := readBackupStatus(f)
+	for i, sheet := range sheets {
+		codelist := codelists[i]
+		if sheet.id != codelist.ID || sheet.name != codelist.CodeListName || sheet.version != codelist.VersionNumber {
+			t.Errorf("sheet %d = %+v, want %s", i, sheet, codelist.ID)
+		}
+		items, _ := readCodelistRows(sheet.id, f.GetRows(sheet.sheet), columns, true)
+		if len(items) != 1 || items[0].senderCode != codelist.Codes[0].SenderCode {
+			t.Errorf("%s: codes %v, want %s", sheet.id, items, codelist.Codes[0].SenderCode)
+		}
+		if status[sheet.id] != codelist.ListStatus {
+			t.Errorf("%s: status %d, want %d", sheet.id, status[sheet.id], codelist.ListStatus)
+		}
+	}
+}
+
+func TestBackupSheetsByID(t *testing.T) {
+	// backup files written before the Versions sheet had a Sheet column
+	f := excelize.NewFile()
+	f.NewSheet("LIST|||2")
+	f.NewSheet(backupVersionsSheet)
+	f.SetCellValue(backupVersionsSheet, "A1", "ID")
+	f.SetCellValue(backupVersionsSheet, "A2", "LIST|||2")
+	sheets, errors := readBackupSheets(f)
+	if len(errors) > 0 || len(sheets) != 1 || sheets[0].sheet != "LIST|||2" || sheets[0].name != "LIST" || sheets[0].version != 2 {
+		t.Errorf("readBackupSheets = %+v %v", sheets, errors)
+	}
+
+	f.DeleteSheet(backupVersionsSheet)
+	sheets, errors = readBackupSheets(f)
+	if len(errors) > 0 || len(sheets) != 1 || sheets[0].id != "LIST|||2" {
+		t.Errorf("readBackupSheets without Versions = %+v %v", sheets, errors)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"gopkg.in/ini.v1"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// textSlot describes the use of one of the Text1 to Text9 fields of a code
+// list.
+type textSlot struct {
+	title    string
+	kind     string
+	values   []string
+	required bool
+}
+
+// listSchema maps the text fields of a code list to their description.
+// It is read from the [schema:<code list name>] section of the configuration
+// file, each key is a text field and its value is the business name
+// followed by the type (string, int, decimal or enum(a|b|c), default string)
+// and required:
+//
+//	[schema:AMF_XREF_SAP_UOM]
+//	text1 = UOM Factor, decimal, required
+//	text2 = Partner Qualifier, enum(ZZ|01|14)
+//	text6 = SAP Plant
+type listSchema map[string]textSlot
+
+var enumKind = regexp.MustCompile(`^enum\((.*)\)$`)
+
+var decimalValue = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)$`)
+
+// loadSchema returns the schema of a code list (config may be nil), the
+// errors are returned for the keys that could not be read.
+func loadSchema(config *ini.File, codelist string) (listSchema, []string) {
+	schema := make(listSchema)
+	schemaErrors := make([]string, 0)
+	if config == nil {
+		return schema, schemaErrors
+	}
+	section := "schema:" + codelist
+	sec, err := config.GetSection(section)
+	if err != nil {
+		return schema, schemaErrors
+	}
+	for _, key := range sec.Keys() {
+		field := strings.ToLower(key.Name())
+		if !strings.HasPrefix(field, "text") || !isFieldName(field) {
+			schemaErrors = append(schemaErrors, "ERROR: ["+section+"] "+key.Name()+" is not one of text1 to text9")
+			continue
+		}
+		parts := strings.Split(key.String(), ",")
+		slot := textSlot{title: strings.TrimSpace(parts[0]), kind: "string"}
+		if slot.title == "" {
+			schemaErrors = append(schemaErrors, "ERROR: ["+section+"] missing name for "+key.Name())
+			continue
+		}
+		valid := true
+		for _, part := range parts[1:] {
+			option := strings.TrimSpace(part)
+			switch {
+			case strings.EqualFold(option, "required"):
+				slot.required = true
+			case strings.EqualFold(option, "optional"):
+				slot.required = false
+			case option == "string" || option == "int" || option == "decimal":
+				slot.kind = option
+			case enumKind.MatchString(option):
+				slot.kind = "enum"
+				for _, value := range strings.Split(enumKind.FindStringSubmatch(option)[1], "|") {
+					if strings.TrimSpace(value) != "" {
+						slot.values = append(slot.values, strings.TrimSpace(value))
+					}
+				}
+			default:
+				schemaErrors = append(schemaErrors, "ERROR: ["+section+"] invalid type \""+option+"\" for "+key.Name())
+				valid = false
+			}
+		}
+		if valid {
+			schema[field] = slot
+		}
+	}
+	return schema, schemaErrors
+}
+
+// header returns the header row of a code list sheet, the text fields with
+// a business name are titled with it.
+func (schema listSchema) header(firstColumn string) []string {
+	header := []string{firstColumn, "SenderCode", "ReceiverCode", "Description"}
+	for i := 1; i <= 9; i++ {
+		title := "Text" + strconv.Itoa(i)
+		if slot, ok := schema["text"+strconv.Itoa(i)]; ok {
+			title = slot.title
+		}
+		header = append(header, title)
+	}
+	return header
+}
+
+// aliases returns the column titles of a code list, the business names of
+// the schema are added to the titles of the [columns] section. A name used
+// twice in the schema is an error, one field would be read into the other.
+func (schema listSchema) aliases(columns map[string]string) (map[string]string, []string) {
+	aliases := make(map[string]string, len(columns)+len(schema))
+	for title, field := range columns {
+		aliases[title] = field
+	}
+	aliasErrors := make([]string, 0)
+	names := make(map[string]string, len(schema))
+	for i := 1; i <= 9; i++ {
+		field := "text" + strconv.Itoa(i)
+		slot, ok := schema[field]
+		if !ok {
+			continue
+		}
+		title := columnTitle(slot.title)
+		if other, ok := columns[title]; ok && other != field {
+			aliasErrors = append(aliasErrors, "ERROR: schema name \""+slot.title+"\" of "+field+" is already the title of "+other)
+			continue
+		}
+		if other, ok := names[title]; ok {
+			aliasErrors = append(aliasErrors, "ERROR: schema name \""+slot.title+"\" of "+field+" is already the name of "+other)
+			continue
+		}
+		names[title] = field
+		aliases[title] = field
+	}
+	return aliases, aliasErrors
+}
+
+// listColumns returns the column titles of a code list sheet including the
+// names of its schema.
+func (mgr *apiMgr) listColumns(codelist string) map[string]string {
+	schema, schemaErrors := loadSchema(mgr.config, codelist)
+	aliases, aliasErrors := schema.aliases(mgr.columns)
+	for _, errormsg := range append(schemaErrors, aliasErrors...) {
+		mgr.addError(errormsg)
+	}
+	return aliases
+}
+
+// checkSchemas adds the errors of the schemas of the code lists, it is called
+// before any change so that an invalid schema section stops the command.
+func (mgr *apiMgr) checkSchemas(names []string) bool {
+	valid := true
+	for _, name := range names {
+		schema, schemaErrors := loadSchema(mgr.config, name)
+		_, aliasErrors := schema.aliases(mgr.columns)
+		for _, errormsg := range append(schemaErrors, aliasErrors...) {
+			mgr.addError(errormsg)
+			valid = false
+		}
+	}
+	return valid
+}
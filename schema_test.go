@@ -0,0 +1,37 @@
+package main
+
+import (
+	"gopkg.in/ini.v1"
+	"strings"
+	"testing"
+)
+
+func TestCheckSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		valid  bool
+		want   string
+	}{
+		{"business names", "[schema:LIST]\ntext1 = UOM Factor, decimal\ntext2 = SAP Plant\n", true, ""},
+		{"name used twice", "[schema:LIST]\ntext1 = Plant\ntext6 = plant\n", false, "schema name \"plant\" of text6 is already the name of text1"},
+		{"name of a column", "[columns]\nsenderCode = Plant\n[schema:LIST]\ntext2 = Plant\n", false, "schema name \"Plant\" of text2 is already the title of senderCode"},
+		{"invalid type", "[schema:LIST]\ntext1 = Factor, float\n", false, "invalid type \"float\" for text1"},
+	}
+	for _, test := range tests {
+		config, err := ini.Load([]byte(test.config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns, _ := loadColumnAliases(config)
+		mgr := &apiMgr{config: config, columns: columns}
+		valid := mgr.checkSchemas([]string{"LIST"})
+		if valid != test.valid {
+			t.Errorf("%s: checkSchemas = %v, want %v (%v)", test.name, valid, test.valid, mgr.errorsList)
+			continue
+		}
+		if !test.valid && (len(mgr.errorsList) != 1 || !strings.Contains(mgr.errorsList[0], test.want)) {
+			t.Errorf("%s: errors %v, want one error with %q", test.name, mgr.errorsList, test.want)
+		}
+	}
+}
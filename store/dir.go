@@ -0,0 +1,156 @@
+package store
+
+import (
+	"codelistmgr/b2bapi"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DirStore keeps the code lists in a directory, each version is a JSON
+// file in the model of the REST API: <dir>/<code list name>/<version>.json.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a store for a directory, it is created when the first
+// code list is put.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+// dirName escapes a code list name into a directory name, the : of a drive
+// letter and the dots of names such as .. are escaped too so that every
+// name stays below the store directory.
+func dirName(name string) string {
+	escaped := strings.ReplaceAll(url.PathEscape(name), ":", "%3A")
+	if strings.Trim(escaped, ".") == "" {
+		escaped = strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return escaped
+}
+
+func (s *DirStore) listDir(name string) string {
+	return filepath.Join(s.dir, dirName(name))
+}
+
+func (s *DirStore) versionFile(name string, version int) string {
+	return filepath.Join(s.listDir(name), strconv.Itoa(version)+".json")
+}
+
+func (s *DirStore) List() ([]b2bapi.CodeList, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return make([]b2bapi.CodeList, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	codelists := make([]b2bapi.CodeList, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+		versions, err := s.Versions(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, codelist := range versions {
+			codelist.Codes = nil
+			codelists = append(codelists, codelist)
+		}
+	}
+	return codelists, nil
+}
+
+func (s *DirStore) Versions(name string) ([]b2bapi.CodeList, error) {
+	files, err := ioutil.ReadDir(s.listDir(name))
+	if os.IsNotExist(err) {
+		return make([]b2bapi.CodeList, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]b2bapi.CodeList, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.listDir(name), file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var codelist b2bapi.CodeList
+		err = json.Unmarshal(data, &codelist)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, codelist)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNumber < versions[j].VersionNumber })
+	return versions, nil
+}
+
+func (s *DirStore) Get(name string, version int) (*b2bapi.CodeList, error) {
+	versions, err := s.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	return SelectVersion(versions, version)
+}
+
+func (s *DirStore) Put(codelist b2bapi.CodeList) error {
+	if codelist.CodeListName == "" {
+		return fmt.Errorf("missing code list name")
+	}
+	versions, err := s.Versions(codelist.CodeListName)
+	if err != nil {
+		return err
+	}
+	codelist = nextVersion(codelist, versions)
+	err = os.MkdirAll(s.listDir(codelist.CodeListName), 0755)
+	if err != nil {
+		return err
+	}
+	if codelist.ListStatus == 1 {
+		for _, existing := range versions {
+			if existing.ListStatus == 1 {
+				existing.ListStatus = 0
+				if err := s.write(existing); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return s.write(codelist)
+}
+
+func (s *DirStore) write(codelist b2bapi.CodeList) error {
+	data, err := json.MarshalIndent(codelist, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.versionFile(codelist.CodeListName, codelist.VersionNumber), append(data, '\n'), 0644)
+}
+
+func (s *DirStore) Delete(name string, version int) error {
+	err := os.Remove(s.versionFile(name, version))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	os.Remove(s.listDir(name))
+	return nil
+}
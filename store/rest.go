@@ -0,0 +1,45 @@
+package store
+
+import (
+	"codelistmgr/b2bapi"
+)
+
+// RESTStore keeps the code lists in B2Bi through its REST API.
+type RESTStore struct {
+	client *b2bapi.Client
+}
+
+// NewRESTStore returns a store for the B2Bi instance of the client.
+func NewRESTStore(client *b2bapi.Client) *RESTStore {
+	return &RESTStore{client: client}
+}
+
+func (s *RESTStore) List() ([]b2bapi.CodeList, error) {
+	return s.client.List(b2bapi.ListOptions{ExcludeCodes: true})
+}
+
+func (s *RESTStore) Versions(name string) ([]b2bapi.CodeList, error) {
+	return s.client.GetVersions(name)
+}
+
+func (s *RESTStore) Get(name string, version int) (*b2bapi.CodeList, error) {
+	versions, err := s.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	return SelectVersion(versions, version)
+}
+
+// Put creates a new version of the code list, B2Bi numbers the version and
+// sets its creation date and user.
+func (s *RESTStore) Put(codelist b2bapi.CodeList) error {
+	return s.client.Create(b2bapi.CreateRequest{CodeListName: codelist.CodeListName, ListStatus: codelist.ListStatus, Codes: codelist.Codes})
+}
+
+func (s *RESTStore) Delete(name string, version int) error {
+	err := s.client.Delete(ID(name, version))
+	if b2bapi.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
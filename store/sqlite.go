@@ -0,0 +1,181 @@
+package store
+
+import (
+	"codelistmgr/b2bapi"
+	"database/sql"
+	_ "modernc.org/sqlite"
+	"time"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS code_lists (
+	name        TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	status      INTEGER NOT NULL,
+	user_name   TEXT NOT NULL DEFAULT '',
+	create_date TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (name, version)
+);
+CREATE TABLE IF NOT EXISTS codes (
+	name          TEXT NOT NULL,
+	version       INTEGER NOT NULL,
+	position      INTEGER NOT NULL,
+	sender_code   TEXT NOT NULL,
+	receiver_code TEXT NOT NULL DEFAULT '',
+	description   TEXT NOT NULL DEFAULT '',
+	text1 TEXT NOT NULL DEFAULT '', text2 TEXT NOT NULL DEFAULT '', text3 TEXT NOT NULL DEFAULT '',
+	text4 TEXT NOT NULL DEFAULT '', text5 TEXT NOT NULL DEFAULT '', text6 TEXT NOT NULL DEFAULT '',
+	text7 TEXT NOT NULL DEFAULT '', text8 TEXT NOT NULL DEFAULT '', text9 TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (name, version, position)
+);`
+
+// SQLiteStore keeps the code lists in a SQLite database file.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens the database file, it is created with its tables
+// when it does not exist.
+func OpenSQLiteStore(file string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) queryCodeLists(query string, args ...interface{}) ([]b2bapi.CodeList, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	codelists := make([]b2bapi.CodeList, 0)
+	for rows.Next() {
+		var codelist b2bapi.CodeList
+		var created string
+		err := rows.Scan(&codelist.CodeListName, &codelist.VersionNumber, &codelist.ListStatus, &codelist.UserName, &created)
+		if err != nil {
+			return nil, err
+		}
+		codelist.ID = ID(codelist.CodeListName, codelist.VersionNumber)
+		if t, err := time.Parse(b2bapi.TimeFormat, created); err == nil {
+			codelist.CreateDate = b2bapi.Timestamp{Time: t}
+		}
+		codelists = append(codelists, codelist)
+	}
+	return codelists, rows.Err()
+}
+
+func (s *SQLiteStore) List() ([]b2bapi.CodeList, error) {
+	return s.queryCodeLists(`SELECT name, version, status, user_name, create_date FROM code_lists ORDER BY name, version`)
+}
+
+func (s *SQLiteStore) Versions(name string) ([]b2bapi.CodeList, error) {
+	versions, err := s.queryCodeLists(`SELECT name, version, status, user_name, create_date FROM code_lists WHERE name = ? ORDER BY version`, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		versions[i].Codes, err = s.codes(name, versions[i].VersionNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (s *SQLiteStore) codes(name string, version int) ([]b2bapi.Code, error) {
+	rows, err := s.db.Query(`SELECT sender_code, receiver_code, description, text1, text2, text3, text4, text5, text6, text7, text8, text9
+		FROM codes WHERE name = ? AND version = ? ORDER BY position`, name, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	codes := make([]b2bapi.Code, 0)
+	for rows.Next() {
+		var c b2bapi.Code
+		err := rows.Scan(&c.SenderCode, &c.ReceiverCode, &c.Description, &c.Text1, &c.Text2, &c.Text3, &c.Text4, &c.Text5, &c.Text6, &c.Text7, &c.Text8, &c.Text9)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+func (s *SQLiteStore) Get(name string, version int) (*b2bapi.CodeList, error) {
+	versions, err := s.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	return SelectVersion(versions, version)
+}
+
+func (s *SQLiteStore) Put(codelist b2bapi.CodeList) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var last sql.NullInt64
+	err = tx.QueryRow(`SELECT MAX(version) FROM code_lists WHERE name = ?`, codelist.CodeListName).Scan(&last)
+	if err != nil {
+		return err
+	}
+	existing := make([]b2bapi.CodeList, 0, 1)
+	if last.Valid {
+		existing = append(existing, b2bapi.CodeList{VersionNumber: int(last.Int64)})
+	}
+	codelist = nextVersion(codelist, existing)
+	if codelist.ListStatus == 1 {
+		_, err = tx.Exec(`UPDATE code_lists SET status = 0 WHERE name = ? AND status = 1`, codelist.CodeListName)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO code_lists (name, version, status, user_name, create_date) VALUES (?, ?, ?, ?, ?)`,
+		codelist.CodeListName, codelist.VersionNumber, codelist.ListStatus, codelist.UserName, codelist.CreateDate.Format(b2bapi.TimeFormat))
+	if err != nil {
+		return err
+	}
+	for i, c := range codelist.Codes {
+		_, err = tx.Exec(`INSERT INTO codes (name, version, position, sender_code, receiver_code, description, text1, text2, text3, text4, text5, text6, text7, text8, text9)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			codelist.CodeListName, codelist.VersionNumber, i, c.SenderCode, c.ReceiverCode, c.Description, c.Text1, c.Text2, c.Text3, c.Text4, c.Text5, c.Text6, c.Text7, c.Text8, c.Text9)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Delete(name string, version int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`DELETE FROM code_lists WHERE name = ? AND version = ?`, name, version)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	_, err = tx.Exec(`DELETE FROM codes WHERE name = ? AND version = ?`, name, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,138 @@
+// Package store keeps code lists in B2Bi, in a directory or in a SQLite
+// database behind the same interface.
+package store
+
+import (
+	"codelistmgr/b2bapi"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a code list, or one of its versions, does
+// not exist in a store.
+var ErrNotFound = errors.New("code list not found")
+
+// CodeListStore is a place code lists are kept in.
+type CodeListStore interface {
+	// List returns every version of every code list without their codes.
+	List() ([]b2bapi.CodeList, error)
+	// Versions returns the versions of a code list with their codes in
+	// version order.
+	Versions(name string) ([]b2bapi.CodeList, error)
+	// Get returns a version of a code list, the active version (or the
+	// highest one) when version is 0.
+	Get(name string, version int) (*b2bapi.CodeList, error)
+	// Put stores the codes as a new version of the code list, an active
+	// version deactivates the earlier ones.
+	Put(codelist b2bapi.CodeList) error
+	// Delete removes a version of a code list.
+	Delete(name string, version int) error
+}
+
+// SelectVersion returns a version of a code list, the version resolved by
+// ResolveVersion when version is 0.
+func SelectVersion(versions []b2bapi.CodeList, version int) (*b2bapi.CodeList, error) {
+	if version == 0 {
+		if len(versions) == 0 {
+			return nil, ErrNotFound
+		}
+		return ResolveVersion(versions[0].CodeListName, versions)
+	}
+	for i := range versions {
+		if versions[i].VersionNumber == version {
+			return &versions[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ResolveVersion returns the version of the named code list an update or an
+// export works with: its active version, or its highest version when none
+// is active. Names are matched exactly, an error is returned when two
+// versions could be selected.
+func ResolveVersion(name string, versions []b2bapi.CodeList) (*b2bapi.CodeList, error) {
+	var active, highest []*b2bapi.CodeList
+	for i := range versions {
+		codelist := &versions[i]
+		if codelist.CodeListName != name {
+			continue
+		}
+		if codelist.ListStatus == 1 {
+			active = append(active, codelist)
+		}
+		if len(highest) == 0 || codelist.VersionNumber > highest[0].VersionNumber {
+			highest = []*b2bapi.CodeList{codelist}
+		} else if codelist.VersionNumber == highest[0].VersionNumber {
+			highest = append(highest, codelist)
+		}
+	}
+	switch {
+	case len(active) == 1:
+		return active[0], nil
+	case len(active) > 1:
+		return nil, &AmbiguousError{Name: name, Reason: "active versions", Versions: active}
+	case len(highest) == 1:
+		return highest[0], nil
+	case len(highest) > 1:
+		return nil, &AmbiguousError{Name: name, Reason: "inactive versions numbered " + strconv.Itoa(highest[0].VersionNumber), Versions: highest}
+	}
+	return nil, ErrNotFound
+}
+
+// AmbiguousError is returned when more than one version of a code list
+// could be selected.
+type AmbiguousError struct {
+	Name     string
+	Reason   string
+	Versions []*b2bapi.CodeList
+}
+
+func (e *AmbiguousError) Error() string {
+	ids := make([]string, 0, len(e.Versions))
+	for _, codelist := range e.Versions {
+		ids = append(ids, codelist.ID)
+	}
+	return fmt.Sprintf("code list %q is ambiguous, %d %s: %s", e.Name, len(e.Versions), e.Reason, strings.Join(ids, ", "))
+}
+
+// Names returns the sorted names of the code lists.
+func Names(codelists []b2bapi.CodeList) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, codelist := range codelists {
+		if !seen[codelist.CodeListName] {
+			seen[codelist.CodeListName] = true
+			names = append(names, codelist.CodeListName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nextVersion prepares a code list put into a local store as the version
+// following the existing ones.
+func nextVersion(codelist b2bapi.CodeList, versions []b2bapi.CodeList) b2bapi.CodeList {
+	codelist.VersionNumber = 1
+	for _, existing := range versions {
+		if existing.VersionNumber >= codelist.VersionNumber {
+			codelist.VersionNumber = existing.VersionNumber + 1
+		}
+	}
+	codelist.ID = ID(codelist.CodeListName, codelist.VersionNumber)
+	if codelist.CreateDate.IsZero() {
+		codelist.CreateDate = b2bapi.Timestamp{Time: time.Now()}
+	}
+	if codelist.Codes == nil {
+		codelist.Codes = make([]b2bapi.Code, 0)
+	}
+	return codelist
+}
+
+// ID returns the _id of a code list version as used by B2Bi.
+func ID(name string, version int) string {
+	return name + "|||" + strconv.Itoa(version)
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"codelistmgr/b2bapi"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// localStores returns the stores kept on disk, each test gets an empty one.
+func localStores() []struct {
+	name string
+	open func(t *testing.T) CodeListStore
+} {
+	return []struct {
+		name string
+		open func(t *testing.T) CodeListStore
+	}{
+		{"dir", func(t *testing.T) CodeListStore {
+			return NewDirStore(filepath.Join(t.TempDir(), "store"))
+		}},
+		{"sqlite", func(t *testing.T) CodeListStore {
+			s, err := OpenSQLiteStore(":memory:")
+			if err != nil {
+				t.Fatalf("OpenSQLiteStore: %v", err)
+			}
+			// every connection has its own in-memory database
+			s.db.SetMaxOpenConns(1)
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+	}
+}
+
+func codes(senderCodes ...string) []b2bapi.Code {
+	codes := make([]b2bapi.Code, 0, len(senderCodes))
+	for _, senderCode := range senderCodes {
+		codes = append(codes, b2bapi.Code{SenderCode: senderCode, ReceiverCode: "R" + senderCode, Text2: "t"})
+	}
+	return codes
+}
+
+func senderCodes(codelist *b2bapi.CodeList) []string {
+	codes := make([]string, 0, len(codelist.Codes))
+	for _, code := range codelist.Codes {
+		codes = append(codes, code.SenderCode)
+	}
+	return codes
+}
+
+func TestStoreVersions(t *testing.T) {
+	puts := []struct {
+		status  int
+		codes   []string
+		version int
+	}{
+		{1, []string{"A", "B"}, 1},
+		{1, []string{"C"}, 2},
+		{0, []string{"D"}, 3},
+	}
+	gets := []struct {
+		version int
+		codes   []string
+		status  int
+	}{
+		{0, []string{"C"}, 1},
+		{1, []string{"A", "B"}, 0},
+		{2, []string{"C"}, 1},
+		{3, []string{"D"}, 0},
+	}
+	for _, local := range localStores() {
+		t.Run(local.name, func(t *testing.T) {
+			s := local.open(t)
+			for _, put := range puts {
+				err := s.Put(b2bapi.CodeList{CodeListName: "LIST", ListStatus: put.status, Codes: codes(put.codes...)})
+				if err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+			}
+			versions, err := s.Versions("LIST")
+			if err != nil || len(versions) != len(puts) {
+				t.Fatalf("Versions = %d versions, %v, want %d", len(versions), err, len(puts))
+			}
+			for i, put := range puts {
+				if versions[i].VersionNumber != put.version || versions[i].ID != ID("LIST", put.version) {
+					t.Errorf("version %d is %s", put.version, versions[i].ID)
+				}
+			}
+			for _, get := range gets {
+				codelist, err := s.Get("LIST", get.version)
+				if err != nil {
+					t.Errorf("Get(%d): %v", get.version, err)
+					continue
+				}
+				if !reflect.DeepEqual(senderCodes(codelist), get.codes) || codelist.ListStatus != get.status {
+					t.Errorf("Get(%d) = %v status %d, want %v status %d", get.version, senderCodes(codelist), codelist.ListStatus, get.codes, get.status)
+				}
+				if codelist.Codes[0].Text2 != "t" {
+					t.Errorf("Get(%d) lost the text columns: %+v", get.version, codelist.Codes[0])
+				}
+			}
+		})
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		want    error
+	}{
+		{"LIST", 1, nil},
+		{"LIST", 1, ErrNotFound},
+		{"LIST", 9, ErrNotFound},
+		{"OTHER", 1, ErrNotFound},
+		{"LIST", 2, nil},
+	}
+	for _, local := range localStores() {
+		t.Run(local.name, func(t *testing.T) {
+			s := local.open(t)
+			for i := 0; i < 2; i++ {
+				if err := s.Put(b2bapi.CodeList{CodeListName: "LIST", ListStatus: 1, Codes: codes("A")}); err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+			}
+			for _, test := range tests {
+				if err := s.Delete(test.name, test.version); err != test.want {
+					t.Errorf("Delete(%s, %d) = %v, want %v", test.name, test.version, err, test.want)
+				}
+			}
+			if _, err := s.Get("LIST", 0); err != ErrNotFound {
+				t.Errorf("Get of a deleted code list = %v, want ErrNotFound", err)
+			}
+			codelists, err := s.List()
+			if err != nil || len(codelists) != 0 {
+				t.Errorf("List after Delete = %v, %v", codelists, err)
+			}
+		})
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	names := []string{"..", ".", "c:x", "a/b", "R&D Supplies #2", "LIST"}
+	for _, local := range localStores() {
+		t.Run(local.name, func(t *testing.T) {
+			s := local.open(t)
+			for _, name := range names {
+				if err := s.Put(b2bapi.CodeList{CodeListName: name, ListStatus: 1, Codes: codes("A")}); err != nil {
+					t.Fatalf("Put(%q): %v", name, err)
+				}
+			}
+			if err := s.Put(b2bapi.CodeList{CodeListName: "LIST", ListStatus: 1, Codes: codes("B")}); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			codelists, err := s.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(codelists) != len(names)+1 {
+				t.Errorf("List returned %d versions, want %d", len(codelists), len(names)+1)
+			}
+			for _, codelist := range codelists {
+				if len(codelist.Codes) != 0 {
+					t.Errorf("List returned the codes of %s", codelist.ID)
+				}
+			}
+			if got := Names(codelists); !reflect.DeepEqual(got, sortedNames(names)) {
+				t.Errorf("List names = %q, want %q", got, sortedNames(names))
+			}
+			for _, name := range names {
+				codelist, err := s.Get(name, 0)
+				if err != nil || codelist.CodeListName != name {
+					t.Errorf("Get(%q) = %v, %v", name, codelist, err)
+				}
+			}
+		})
+	}
+}
+
+func sortedNames(names []string) []string {
+	codelists := make([]b2bapi.CodeList, 0, len(names))
+	for _, name := range names {
+		codelists = append(codelists, b2bapi.CodeList{CodeListName: name})
+	}
+	return Names(codelists)
+}
+
+func TestDirStoreNames(t *testing.T) {
+	// the names of the store directory entries, no code list may be kept
+	// outside of it
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"..", "%2E%2E"},
+		{".", "%2E"},
+		{"c:x", "c%3Ax"},
+		{"a/b", "a%2Fb"},
+		{"..a", "..a"},
+		{"R&D Supplies #2", "R&D%20Supplies%20%232"},
+	}
+	for _, test := range tests {
+		if got := dirName(test.name); got != test.want {
+			t.Errorf("dirName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	parent := t.TempDir()
+	s := NewDirStore(filepath.Join(parent, "store"))
+	for _, test := range tests {
+		if err := s.Put(b2bapi.CodeList{CodeListName: test.name, Codes: codes("A")}); err != nil {
+			t.Fatalf("Put(%q): %v", test.name, err)
+		}
+	}
+	entries, err := ioutil.ReadDir(parent)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "store" {
+		t.Errorf("the store wrote outside its directory: %v %v", entries, err)
+	}
+	if err := s.Put(b2bapi.CodeList{}); err == nil {
+		t.Errorf("Put without a name succeeded")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// strategyReplace deletes every version of the code list before the
+	// codes of the input document are loaded.
+	strategyReplace = "replace"
+	// strategyNewVersion creates a new active version of the code list and
+	// keeps the earlier versions for a rollback.
+	strategyNewVersion = "new-version"
+	// strategyMerge adds and updates the codes of the input document in the
+	// live code list, the other live codes are kept.
+	strategyMerge = "merge"
+)
+
+// Actions of the first column of a code list sheet, Yes and No are the
+// values of the original template.
+const (
+	actionYes    = "Yes"
+	actionNo     = "No"
+	actionAdd    = "Add"
+	actionUpdate = "Update"
+	actionDelete = "Delete"
+	actionKeep   = "Keep"
+)
+
+var actions = []string{actionYes, actionNo, actionAdd, actionUpdate, actionDelete, actionKeep}
+
+// normalizeAction returns the action matching the value regardless of its
+// case, an empty value is the same as No.
+func normalizeAction(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return actionNo, true
+	}
+	for _, action := range actions {
+		if strings.EqualFold(value, action) {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// loadedItems returns the codes loaded by the replace and new-version
+// strategies, deleted rows are left out and kept rows take the values of
+// the live code.
+func loadedItems(live []codelistItem, items []codelistItem) ([]codelistItem, []string) {
+	current := make(map[string]codelistItem)
+	for _, item := range live {
+		current[item.senderCode] = item
+	}
+	loaded := make([]codelistItem, 0, len(items))
+	loadErrors := make([]string, 0)
+	for _, item := range items {
+		if item.active == actionDelete {
+			continue
+		}
+		if item.active == actionKeep {
+			old, ok := current[item.senderCode]
+			if !ok {
+				loadErrors = append(loadErrors, "ERROR: sendercode "+item.senderCode+" to keep not found, ignoring at row "+strconv.Itoa(item.row))
+				continue
+			}
+			item = old
+		}
+		loaded = append(loaded, item)
+	}
+	return loaded, loadErrors
+}
+
+// isDelta reports whether a row uses the Add, Update, Delete or Keep action,
+// such a sheet holds changes to the live code list.
+func isDelta(items []codelistItem) bool {
+	for _, item := range items {
+		switch item.active {
+		case actionAdd, actionUpdate, actionDelete, actionKeep:
+			return true
+		}
+	}
+	return false
+}
+
+// wantedItems returns the codes loaded by the replace and new-version
+// strategies, a delta sheet is merged into the live codes while any other
+// sheet is the whole code list.
+func wantedItems(live []codelistItem, items []codelistItem) ([]codelistItem, []string) {
+	if isDelta(items) {
+		return mergeCodes(live, items)
+	}
+	return loadedItems(live, items)
+}
+
+// fetchLiveItems returns the codes of the version of the current code list
+// used by the update API along with the _id of every version.
+func (mgr *apiMgr) fetchLiveItems() ([]codelistItem, []string, error) {
+	codelists, err := mgr.fetchCodelists()
+	if err != nil {
+		return nil, nil, err
+	}
+	versions := make([]string, 0)
+	for _, codelist := range codelists {
+		versions = append(versions, codelist.ID)
+	}
+	return liveItems(codelists), versions, nil
+}
+
+// liveItems returns the codes of the version used by the update API, none
+// when the version can not be resolved.
+func liveItems(codelists []b2bapi.CodeList) []codelistItem {
+	live := make([]codelistItem, 0)
+	codelist, err := store.SelectVersion(codelists, 0)
+	if err == nil {
+		for _, code := range codelist.Codes {
+			live = append(live, itemFromCode(code))
+		}
+	}
+	return live
+}
+
+// mergeCodes applies the actions of the wanted codes to the live codes using
+// the sender code as the key, added codes are appended at the end. The
+// errors are returned for the rows that could not be applied.
+func mergeCodes(live []codelistItem, wanted []codelistItem) ([]codelistItem, []string) {
+	merged := make([]codelistItem, 0, len(live)+len(wanted))
+	mergeErrors := make([]string, 0)
+	position := make(map[string]int)
+	deleted := make(map[string]bool)
+	for _, item := range live {
+		position[item.senderCode] = len(merged)
+		merged = append(merged, item)
+	}
+	for _, item := range wanted {
+		pos, exists := position[item.senderCode]
+		exists = exists && !deleted[item.senderCode]
+		switch {
+		case item.active == actionKeep && !exists:
+			mergeErrors = append(mergeErrors, "ERROR: sendercode "+item.senderCode+" to keep not found, ignoring at row "+strconv.Itoa(item.row))
+		case item.active == actionKeep:
+		case item.active == actionDelete && !exists:
+			mergeErrors = append(mergeErrors, "ERROR: sendercode "+item.senderCode+" to delete not found, ignoring at row "+strconv.Itoa(item.row))
+		case item.active == actionDelete:
+			deleted[item.senderCode] = true
+		case item.active == actionAdd && exists:
+			mergeErrors = append(mergeErrors, "ERROR: sendercode "+item.senderCode+" to add already exists, ignoring at row "+strconv.Itoa(item.row))
+		case item.active == actionUpdate && !exists:
+			mergeErrors = append(mergeErrors, "ERROR: sendercode "+item.senderCode+" to update not found, ignoring at row "+strconv.Itoa(item.row))
+		case exists:
+			merged[pos] = item
+		default:
+			if _, ok := position[item.senderCode]; ok {
+				delete(deleted, item.senderCode)
+				merged[pos] = item
+			} else {
+				position[item.senderCode] = len(merged)
+				merged = append(merged, item)
+			}
+		}
+	}
+	result := make([]codelistItem, 0, len(merged))
+	for _, item := range merged {
+		if !deleted[item.senderCode] {
+			result = append(result, item)
+		}
+	}
+	return result, mergeErrors
+}
+
+// mergeLive returns the live codes of the current code list merged with the
+// codes of the input document.
+func (mgr *apiMgr) mergeLive(items []codelistItem) ([]codelistItem, []string, error) {
+	live, _, err := mgr.fetchLiveItems()
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, mergeErrors := mergeCodes(live, items)
+	return merged, mergeErrors, nil
+}
+
+// createVersion creates a new active version of the current code list, the
+// earlier versions are left in place.
+func (mgr *apiMgr) createVersion(items []codelistItem) error {
+	err := mgr.CreateCodelist(items, 1)
+	if err != nil {
+		fmt.Println("Error occurred", err)
+	} else {
+		fmt.Println(mgr.codelist, " new version created.")
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func senderCodes(items []codelistItem) []string {
+	codes := make([]string, 0, len(items))
+	for _, item := range items {
+		codes = append(codes, item.senderCode+"="+item.receiverCode)
+	}
+	return codes
+}
+
+func TestWantedItems(t *testing.T) {
+	live := []codelistItem{
+		{senderCode: "A", receiverCode: "RA"},
+		{senderCode: "B", receiverCode: "RB"},
+		{senderCode: "C", receiverCode: "RC"},
+	}
+	tests := []struct {
+		name  string
+		items []codelistItem
+		want  []string
+	}{
+		{"whole list", []codelistItem{{active: actionYes, senderCode: "D", receiverCode: "RD"}}, []string{"D=RD"}},
+		{"add and delete", []codelistItem{{active: actionAdd, senderCode: "D", receiverCode: "RD"}, {active: actionDelete, senderCode: "A"}}, []string{"B=RB", "C=RC", "D=RD"}},
+		{"update", []codelistItem{{active: actionUpdate, senderCode: "B", receiverCode: "X"}}, []string{"A=RA", "B=X", "C=RC"}},
+		{"keep with yes", []codelistItem{{active: actionKeep, senderCode: "C"}, {active: actionYes, senderCode: "E", receiverCode: "RE"}}, []string{"A=RA", "B=RB", "C=RC", "E=RE"}},
+	}
+	for _, test := range tests {
+		items, errors := wantedItems(live, test.items)
+		if len(errors) > 0 {
+			t.Errorf("%s: unexpected errors %v", test.name, errors)
+		}
+		if got := senderCodes(items); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWantedItemsErrors(t *testing.T) {
+	live := []codelistItem{{senderCode: "A", receiverCode: "RA"}}
+	items, errors := wantedItems(live, []codelistItem{
+		{row: 2, active: actionAdd, senderCode: "A", receiverCode: "X"},
+		{row: 3, active: actionDelete, senderCode: "Z"},
+	})
+	if len(errors) != 2 {
+		t.Errorf("got errors %v, want 2", errors)
+	}
+	if got := senderCodes(items); !reflect.DeepEqual(got, []string{"A=RA"}) {
+		t.Errorf("got %v, want the live code unchanged", got)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// openStore opens a store given as live (B2Bi with the configuration file),
+// dir:<directory> or sqlite:<database file>.
+func openStore(spec, conf string) (store.CodeListStore, error) {
+	switch {
+	case spec == liveSource:
+		service := newService(conf, true)
+		return liveStore{RESTStore: store.NewRESTStore(service.client), mgr: service}, nil
+	case strings.HasPrefix(spec, "dir:"):
+		return store.NewDirStore(strings.TrimPrefix(spec, "dir:")), nil
+	case strings.HasPrefix(spec, "sqlite:"):
+		return store.OpenSQLiteStore(strings.TrimPrefix(spec, "sqlite:"))
+	}
+	return nil, fmt.Errorf("invalid store \"%s\" (live, dir:<directory> or sqlite:<database file>)", spec)
+}
+
+// liveStore is the B2Bi store of a sync, the state of a code list put into
+// it is recorded as applied by this tool so that drift does not report it.
+type liveStore struct {
+	*store.RESTStore
+	mgr *apiMgr
+}
+
+func (s liveStore) Put(codelist b2bapi.CodeList) error {
+	err := s.RESTStore.Put(codelist)
+	if err == nil {
+		s.mgr.codelist = codelist.CodeListName
+		s.mgr.recordApplied()
+	}
+	return err
+}
+
+// closeStores closes the stores holding an open resource, e.g. a SQLite
+// database, the errors are returned.
+func closeStores(stores []store.CodeListStore) []string {
+	closeErrors := make([]string, 0)
+	for _, opened := range stores {
+		if closer, ok := opened.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				closeErrors = append(closeErrors, "ERROR: unable to close a store "+err.Error())
+			}
+		}
+	}
+	return closeErrors
+}
+
+// sameCodes reports whether two code list versions hold the same codes.
+func sameCodes(a, b b2bapi.CodeList) bool {
+	left := make([]codelistItem, 0, len(a.Codes))
+	for _, code := range a.Codes {
+		left = append(left, itemFromCode(code))
+	}
+	right := make([]codelistItem, 0, len(b.Codes))
+	for _, code := range b.Codes {
+		right = append(right, itemFromCode(code))
+	}
+	return !diffCodes(a.CodeListName, left, right).hasChanges()
+}
+
+// runSync copies the active version of the code lists matching the patterns
+// from one store to another, a new active version is put in the target
+// store only when its codes differ.
+func runSync(from, to store.CodeListStore, patterns []string, dryRun bool) []string {
+	syncErrors := make([]string, 0)
+	codelists, err := from.List()
+	if err != nil {
+		return append(syncErrors, "ERROR: unable to read the Code Lists "+err.Error())
+	}
+	names, unmatched := matchNames(store.Names(codelists), patterns)
+	for _, pattern := range unmatched {
+		syncErrors = append(syncErrors, "ERROR: no Code List found for \""+pattern+"\"")
+	}
+	copied := 0
+	for _, name := range names {
+		source, err := from.Get(name, 0)
+		if err != nil {
+			syncErrors = append(syncErrors, "ERROR: unable to read Code List \""+name+"\" "+err.Error())
+			continue
+		}
+		target, err := to.Get(name, 0)
+		if err != nil && err != store.ErrNotFound {
+			syncErrors = append(syncErrors, "ERROR: unable to read Code List \""+name+"\" from the target "+err.Error())
+			continue
+		}
+		if target != nil && target.ListStatus == 1 && sameCodes(*source, *target) {
+			fmt.Printf("%s unchanged.\n", name)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("%s would be copied (version %d, %d code(s)).\n", name, source.VersionNumber, len(source.Codes))
+			copied++
+			continue
+		}
+		err = to.Put(b2bapi.CodeList{
+			CodeListName: name,
+			ListStatus:   1,
+			UserName:     source.UserName,
+			CreateDate:   source.CreateDate,
+			Codes:        source.Codes,
+		})
+		if err != nil {
+			syncErrors = append(syncErrors, "ERROR: unable to copy Code List \""+name+"\" "+err.Error())
+			continue
+		}
+		fmt.Printf("%s copied (version %d, %d code(s)).\n", name, source.VersionNumber, len(source.Codes))
+		copied++
+	}
+	fmt.Printf("%d Code List(s) checked, %d copied.\n", len(names), copied)
+	return syncErrors
+}
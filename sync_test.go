@@ -0,0 +1,89 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSync(t *testing.T) {
+	dir := t.TempDir()
+	from := store.NewDirStore(filepath.Join(dir, "from"))
+	to, err := store.OpenSQLiteStore(filepath.Join(dir, "to.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	put := func(s store.CodeListStore, name string, status int, senderCodes ...string) {
+		codes := make([]b2bapi.Code, 0, len(senderCodes))
+		for _, senderCode := range senderCodes {
+			codes = append(codes, b2bapi.Code{SenderCode: senderCode, ReceiverCode: "R" + senderCode})
+		}
+		if err := s.Put(b2bapi.CodeList{CodeListName: name, ListStatus: status, Codes: codes}); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+	put(from, "SAME", 1, "A", "B")
+	put(to, "SAME", 1, "B", "A")
+	put(from, "CHANGED", 1, "A")
+	put(from, "CHANGED", 0, "C")
+	put(to, "CHANGED", 1, "B")
+	put(from, "NEW", 1, "N")
+	put(from, "..", 1, "D")
+	put(from, "c:x", 1, "E")
+
+	tests := []struct {
+		name     string
+		patterns []string
+		dryRun   bool
+		errors   int
+		versions map[string]int
+	}{
+		{"dry run", nil, true, 0, map[string]int{"SAME": 1, "CHANGED": 1, "NEW": 0}},
+		{"unmatched pattern", []string{"NONE"}, false, 1, map[string]int{"SAME": 1, "CHANGED": 1, "NEW": 0}},
+		{"pattern", []string{"N*"}, false, 0, map[string]int{"SAME": 1, "CHANGED": 1, "NEW": 1}},
+		{"all", nil, false, 0, map[string]int{"SAME": 1, "CHANGED": 2, "NEW": 1, "..": 1, "c:x": 1}},
+		{"again", nil, false, 0, map[string]int{"SAME": 1, "CHANGED": 2, "NEW": 1, "..": 1, "c:x": 1}},
+	}
+	for _, test := range tests {
+		syncErrors := runSync(from, to, test.patterns, test.dryRun)
+		if len(syncErrors) != test.errors {
+			t.Errorf("%s: errors %v, want %d", test.name, syncErrors, test.errors)
+		}
+		for name, want := range test.versions {
+			versions, err := to.Versions(name)
+			if err != nil || len(versions) != want {
+				t.Errorf("%s: %s has %d versions (%v), want %d", test.name, name, len(versions), err, want)
+			}
+		}
+	}
+
+	codelist, err := to.Get("CHANGED", 0)
+	if err != nil || codelist.VersionNumber != 2 || len(codelist.Codes) != 1 || codelist.Codes[0].SenderCode != "A" {
+		t.Errorf("CHANGED was synced as %+v, %v", codelist, err)
+	}
+}
+
+func TestSyncDirNames(t *testing.T) {
+	// names such as .. or c:x must be read back from a directory store
+	dir := t.TempDir()
+	from := store.NewDirStore(filepath.Join(dir, "from"))
+	to := store.NewDirStore(filepath.Join(dir, "to"))
+	for _, name := range []string{"..", ".", "c:x", "a/b"} {
+		if err := from.Put(b2bapi.CodeList{CodeListName: name, ListStatus: 1, Codes: []b2bapi.Code{{SenderCode: "A"}}}); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+	if syncErrors := runSync(from, to, nil, false); len(syncErrors) > 0 {
+		t.Fatalf("runSync: %v", syncErrors)
+	}
+	codelists, err := to.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(store.Names(codelists), " "); names != ". .. a/b c:x" {
+		t.Errorf("synced %q", names)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultMaxLength is the size of the code list columns in the B2Bi
+// database.
+const defaultMaxLength = 255
+
+// validationRules are the checks made on the fields of a code list sheet.
+// They are read from the [rules] section of the configuration file and can
+// be overridden for a code list in a [rules:<code list name>] section:
+//
+//	[rules]
+//	maxlength = 255
+//	illegalchars = <>&
+//
+//	[rules:AMF_XREF_SAP_UOM]
+//	senderCode.regex = ^[A-Z0-9]+$
+//	text1.required = true
+//	text2.values = EA,PK,PL
+//	description.maxlength = 100
+//
+// The types and required flags of the schema of the code list are checked
+// as well.
+type validationRules struct {
+	titles       map[string]string
+	kinds        map[string]string
+	maxLength    map[string]int
+	illegalChars string
+	patterns     map[string]*regexp.Regexp
+	required     map[string]bool
+	values       map[string][]string
+}
+
+type finding struct {
+	sheet   string
+	cell    string
+	message string
+}
+
+func (f finding) String() string {
+	if f.cell == "" {
+		return f.sheet + ": " + f.message
+	}
+	return f.sheet + "!" + f.cell + ": " + f.message
+}
+
+// loadRules returns the rules of a code list, the errors are returned for
+// the keys that could not be read.
+func loadRules(config *ini.File, codelist string) (*validationRules, []string) {
+	rules := &validationRules{
+		titles:    make(map[string]string),
+		kinds:     make(map[string]string),
+		maxLength: make(map[string]int),
+		patterns:  make(map[string]*regexp.Regexp),
+		required:  make(map[string]bool),
+		values:    make(map[string][]string),
+	}
+	for _, field := range fieldNames {
+		rules.maxLength[field] = defaultMaxLength
+	}
+	schema, ruleErrors := loadSchema(config, codelist)
+	for field, slot := range schema {
+		rules.titles[field] = slot.title
+		rules.kinds[field] = slot.kind
+		rules.required[field] = slot.required
+		if slot.kind == "enum" {
+			rules.values[field] = slot.values
+		}
+	}
+	if config == nil {
+		return rules, ruleErrors
+	}
+	for _, name := range []string{"rules", "rules:" + codelist} {
+		sec, err := config.GetSection(name)
+		if err != nil {
+			continue
+		}
+		for _, key := range sec.Keys() {
+			field, option := "", key.Name()
+			if pos := strings.LastIndex(option, "."); pos > 0 {
+				field, option = option[:pos], option[pos+1:]
+				if !isFieldName(field) {
+					ruleErrors = append(ruleErrors, "ERROR: ["+name+"] unknown field in "+key.Name())
+					continue
+				}
+			}
+			switch strings.ToLower(option) {
+			case "maxlength":
+				length, err := key.Int()
+				if err != nil || length <= 0 {
+					ruleErrors = append(ruleErrors, "ERROR: ["+name+"] invalid length in "+key.Name())
+					continue
+				}
+				for _, name := range fieldNames {
+					if field == "" || field == name {
+						rules.maxLength[name] = length
+					}
+				}
+			case "illegalchars":
+				rules.illegalChars = key.String()
+			case "regex":
+				pattern, err := regexp.Compile(key.String())
+				if err != nil {
+					ruleErrors = append(ruleErrors, "ERROR: ["+name+"] invalid regex in "+key.Name()+" "+err.Error())
+					continue
+				}
+				rules.patterns[field] = pattern
+			case "required":
+				rules.required[field] = key.MustBool(false)
+			case "values":
+				rules.values[field] = splitList(key.String())
+			default:
+				ruleErrors = append(ruleErrors, "ERROR: ["+name+"] unknown rule "+key.Name())
+			}
+		}
+	}
+	return rules, ruleErrors
+}
+
+func isFieldName(name string) bool {
+	for _, field := range fieldNames {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkField returns the problems found in the value of a field.
+func (rules *validationRules) checkField(field string, value string) []string {
+	problems := make([]string, 0)
+	label := field
+	if title, ok := rules.titles[field]; ok {
+		label = field + " (" + title + ")"
+	}
+	if value == "" {
+		if rules.required[field] {
+			problems = append(problems, label+" is required")
+		}
+		return problems
+	}
+	if utf8.RuneCountInString(value) > rules.maxLength[field] {
+		problems = append(problems, fmt.Sprintf("%s is longer than %d characters", label, rules.maxLength[field]))
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) || strings.ContainsRune(rules.illegalChars, r) {
+			problems = append(problems, fmt.Sprintf("%s contains the illegal character %q", label, r))
+			break
+		}
+	}
+	switch rules.kinds[field] {
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			problems = append(problems, label+" \""+value+"\" is not an integer")
+		}
+	case "decimal":
+		if !decimalValue.MatchString(value) {
+			problems = append(problems, label+" \""+value+"\" is not a decimal number")
+		}
+	}
+	if pattern, ok := rules.patterns[field]; ok && !pattern.MatchString(value) {
+		problems = append(problems, label+" \""+value+"\" does not match "+pattern.String())
+	}
+	if allowed, ok := rules.values[field]; ok {
+		found := false
+		for _, v := range allowed {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, label+" \""+value+"\" is not one of "+strings.Join(allowed, ", "))
+		}
+	}
+	return problems
+}
+
+// validateRows checks the header and every row of a code list.
+func validateRows(name string, rows [][]string, rules *validationRules, aliases map[string]string, workbook bool) []finding {
+	findings := make([]finding, 0)
+	if len(rows) == 0 {
+		return append(findings, finding{sheet: name, message: "blank sheet"})
+	}
+	layout, warnings, err := readColumnLayout(rows[0], aliases, workbook)
+	for _, warning := range warnings {
+		fmt.Println(name + ": " + warning)
+	}
+	if err != nil {
+		return append(findings, finding{sheet: name, message: "malformed sheet, " + err.Error()})
+	}
+
+	senders := make(map[string]string)
+	codes := 0
+	for r, row := range rows[1:] {
+		rownum := r + 2
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		item := layout.item(row, rownum)
+		action, ok := normalizeAction(item.active)
+		if !ok {
+			findings = append(findings, finding{sheet: name, cell: layout.cell("action", rownum), message: "invalid action \"" + item.active + "\", allowed values are " + strings.Join(actions, ", ")})
+			continue
+		}
+		if action == actionNo {
+			continue
+		}
+		codes++
+		senderCell := layout.cell("senderCode", rownum)
+		if item.senderCode == "" {
+			findings = append(findings, finding{sheet: name, cell: senderCell, message: "senderCode is missing"})
+		} else if first, ok := senders[item.senderCode]; ok {
+			findings = append(findings, finding{sheet: name, cell: senderCell, message: "duplicate senderCode \"" + item.senderCode + "\", first found at " + first})
+		} else {
+			senders[item.senderCode] = senderCell
+		}
+		if item.receiverCode == "" && action != actionDelete && action != actionKeep {
+			findings = append(findings, finding{sheet: name, cell: layout.cell("receiverCode", rownum), message: "receiverCode is missing"})
+		}
+		if action == actionDelete || action == actionKeep {
+			continue
+		}
+		for _, field := range fieldNames[1:] {
+			for _, problem := range rules.checkField(field, layout.value(row, field)) {
+				if _, ok := layout[field]; !ok {
+					findings = append(findings, finding{sheet: name, message: problem + " at row " + strconv.Itoa(rownum) + ", the column is missing"})
+					continue
+				}
+				findings = append(findings, finding{sheet: name, cell: layout.cell(field, rownum), message: problem})
+			}
+		}
+	}
+	if codes == 0 {
+		findings = append(findings, finding{sheet: name, message: "blank sheet, no codes found"})
+	}
+	return findings
+}
+
+// runValidate checks the code list sheets of the input document with the
+// rules of the configuration file (config may be nil), the findings are
+// added to errorsList.
+func runValidate(input, format string, config *ini.File) error {
+	lists, err := readInput(input, format)
+	if err != nil {
+		errorsList = append(errorsList, "ERROR - Invalid input file ["+input+"] "+err.Error())
+		return err
+	}
+	aliases, aliasErrors := loadColumnAliases(config)
+	errorsList = append(errorsList, aliasErrors...)
+	checked := 0
+	for _, list := range lists {
+		name := list.name
+		checked++
+		rules, ruleErrors := loadRules(config, name)
+		errorsList = append(errorsList, ruleErrors...)
+		schema, _ := loadSchema(config, name)
+		listAliases, aliasErrors := schema.aliases(aliases)
+		errorsList = append(errorsList, aliasErrors...)
+		for _, found := range validateRows(name, list.rows, rules, listAliases, list.workbook) {
+			errorsList = append(errorsList, found.String())
+		}
+	}
+	if checked == 0 {
+		errorsList = append(errorsList, "ERROR: invalid input document or CodeList(s) not found")
+	}
+	if len(errorsList) > 0 {
+		return fmt.Errorf("Validation failed")
+	}
+	fmt.Printf("%d Code List(s) checked, no errors found.\n", checked)
+	return nil
+}
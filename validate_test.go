@@ -0,0 +1,149 @@
+package main
+
+import (
+	"gopkg.in/ini.v1"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRows(t *testing.T) {
+	header := []string{"Active", "SenderCode", "ReceiverCode", "Description", "Text1", "Text2"}
+	tests := []struct {
+		name  string
+		rules string
+		rows  [][]string
+		want  []string
+	}{
+		{"no rule", "", [][]string{header, {"Yes", "A", "RA", "", "", ""}}, nil},
+		{"required", "[rules:LIST]\ntext1.required = true\n", [][]string{header, {"Yes", "A", "RA", "", "", ""}, {"Yes", "B", "RB", "", "x", ""}}, []string{"LIST!E2: text1 is required"}},
+		{"required by schema", "[schema:LIST]\ntext1 = Plant, required\n", [][]string{{"Active", "SenderCode", "ReceiverCode"}, {"Yes", "A", "RA"}}, []string{"LIST: text1 (Plant) is required at row 2, the column is missing"}},
+		{"required in a row marked No", "[rules:LIST]\ntext1.required = true\n", [][]string{header, {"No", "A", "RA", "", "", ""}, {"Yes", "B", "RB", "", "x", ""}}, nil},
+		{"pattern", "[rules:LIST]\nsenderCode.regex = ^[A-Z]+$\n", [][]string{header, {"Yes", "A", "RA"}, {"Yes", "a1", "RB"}}, []string{"LIST!B3: senderCode \"a1\" does not match ^[A-Z]+$"}},
+		{"pattern of another list", "[rules:OTHER]\nsenderCode.regex = ^[A-Z]+$\n", [][]string{header, {"Yes", "a1", "RA"}}, nil},
+		{"field length", "[rules:LIST]\ndescription.maxlength = 3\n", [][]string{header, {"Yes", "A", "RA", "long"}, {"Yes", "B", "RB", "abc"}}, []string{"LIST!D2: description is longer than 3 characters"}},
+		{"length of every field", "[rules]\nmaxlength = 2\n", [][]string{header, {"Yes", "ABC", "RA"}}, []string{"LIST!B2: senderCode is longer than 2 characters"}},
+		{"values", "[rules:LIST]\ntext2.values = EA,PK\n", [][]string{header, {"Yes", "A", "RA", "", "", "EA"}, {"Yes", "B", "RB", "", "", "KG"}}, []string{"LIST!F3: text2 \"KG\" is not one of EA, PK"}},
+		{"unique sender code", "", [][]string{header, {"Yes", "A", "RA"}, {"Yes", "B", "RB"}, {"Yes", "A", "RC"}}, []string{"LIST!B4: duplicate senderCode \"A\", first found at B2"}},
+		{"unique sender code of a row marked No", "", [][]string{header, {"Yes", "A", "RA"}, {"No", "A", "RC"}}, nil},
+	}
+	for _, test := range tests {
+		config, err := ini.Load([]byte(test.rules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules, ruleErrors := loadRules(config, "LIST")
+		if len(ruleErrors) > 0 {
+			t.Errorf("%s: rule errors %v", test.name, ruleErrors)
+			continue
+		}
+		schema, _ := loadSchema(config, "LIST")
+		columns, _ := loadColumnAliases(config)
+		aliases, _ := schema.aliases(columns)
+		found := make([]string, 0)
+		for _, finding := range validateRows("LIST", test.rows, rules, aliases, true) {
+			found = append(found, finding.String())
+		}
+		if strings.Join(found, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: findings %q, want %q", test.name, found, test.want)
+		}
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	tests := map[string]string{
+		"[rules]\nsenderCode.regex = ([A-Z]\n":   "invalid regex in senderCode.regex",
+		"[rules]\nmaxlength = none\n":            "invalid length in maxlength",
+		"[rules:LIST]\nsender.required = true\n": "unknown field in sender.required",
+		"[rules:LIST]\ntext1.unique = true\n":    "unknown rule text1.unique",
+	}
+	for rules, want := range tests {
+		config, err := ini.Load([]byte(rules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ruleErrors := loadRules(config, "LIST")
+		if len(ruleErrors) != 1 || !strings.Contains(ruleErrors[0], want) {
+			t.Errorf("loadRules(%q) errors %v, want %q", rules, ruleErrors, want)
+		}
+	}
+}
+
+// writeValidateFiles writes a configuration file and a CSV input document
+// with a duplicate sender code when duplicate is set.
+func writeValidateFiles(t *testing.T, rules string, duplicate bool) (string, string) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "apimgr.conf")
+	input := filepath.Join(dir, "LIST.csv")
+	rows := "SenderCode,ReceiverCode\nA,RA\nB,RB\n"
+	if duplicate {
+		rows += "A,RC\n"
+	}
+	if err := ioutil.WriteFile(conf, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(input, []byte(rows), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return conf, input
+}
+
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     string
+		duplicate bool
+		want      string
+	}{
+		{"valid", "[rules]\nmaxlength = 10\n", false, ""},
+		{"finding", "", true, "LIST!A4: duplicate senderCode \"A\", first found at A2"},
+		{"invalid rule", "[rules]\nsenderCode.regex = ([A-Z]\n", false, "ERROR: [rules] invalid regex in senderCode.regex"},
+	}
+	for _, test := range tests {
+		conf, input := writeValidateFiles(t, test.rules, test.duplicate)
+		errorsList = nil
+		err := runValidate(input, "", loadConfig(conf))
+		if (err != nil) != (test.want != "") {
+			t.Errorf("%s: runValidate returned %v, errors %v", test.name, err, errorsList)
+			continue
+		}
+		if test.want != "" && (len(errorsList) != 1 || !strings.HasPrefix(errorsList[0], test.want)) {
+			t.Errorf("%s: errors %v, want %q", test.name, errorsList, test.want)
+		}
+	}
+	errorsList = nil
+}
+
+func TestValidateCommandExit(t *testing.T) {
+	if args := os.Getenv("CODELISTMGR_VALIDATE"); args != "" {
+		validateCommand(strings.Split(args, " "))
+		return
+	}
+	tests := []struct {
+		name      string
+		duplicate bool
+		exitCode  int
+	}{
+		{"valid", false, 0},
+		// the exit status is cut to 8 bits, 10004 is seen as 20
+		{"finding", true, 10004 % 256},
+	}
+	for _, test := range tests {
+		conf, input := writeValidateFiles(t, "", test.duplicate)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestValidateCommandExit$")
+		cmd.Env = append(os.Environ(), "CODELISTMGR_VALIDATE=-conf "+conf+" "+input)
+		output, err := cmd.CombinedOutput()
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if exitCode != test.exitCode {
+			t.Errorf("%s: validate exited with %d, want %d\n%s", test.name, exitCode, test.exitCode, output)
+		}
+	}
+}
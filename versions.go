@@ -0,0 +1,211 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"codelistmgr/store"
+	"fmt"
+	"sort"
+)
+
+// listVersions reads the versions of the current code list in version order.
+func (mgr *apiMgr) listVersions() ([]b2bapi.CodeList, error) {
+	versions, err := mgr.fetchCodelists()
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("Code List \"%s\" not found", mgr.codelist)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNumber < versions[j].VersionNumber })
+	return versions, nil
+}
+
+// latestVersion returns the version of the current code list with the
+// highest version number.
+func (mgr *apiMgr) latestVersion() (b2bapi.CodeList, error) {
+	versions, err := mgr.listVersions()
+	if err != nil {
+		return b2bapi.CodeList{}, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// runVersions prints the versions of a code list.
+func (mgr *apiMgr) runVersions(name string) error {
+	mgr.codelist = name
+	versions, err := mgr.listVersions()
+	if err != nil {
+		mgr.addError("ERROR: " + err.Error())
+		return err
+	}
+	fmt.Printf("Code List \"%s\"\n", name)
+	fmt.Printf("%8s %8s %-20s %-20s %8s\n", "Version", "Status", "Created", "User", "Codes")
+	for _, codelist := range versions {
+		created := ""
+		if !codelist.CreateDate.IsZero() {
+			created = codelist.CreateDate.Format("2006-01-02 15:04:05")
+		}
+		status := "inactive"
+		if codelist.ListStatus == 1 {
+			status = "active"
+		}
+		fmt.Printf("%8d %8s %-20s %-20s %8d\n", codelist.VersionNumber, status, created, codelist.UserName, len(codelist.Codes))
+	}
+	fmt.Printf("%d version(s) found.\n", len(versions))
+	return nil
+}
+
+// activateVersion makes a version of a code list the active one.
+func (mgr *apiMgr) activateVersion(name string, version int) error {
+	mgr.codelist = name
+	versions, err := mgr.listVersions()
+	if err != nil {
+		mgr.addError("ERROR: " + err.Error())
+		return err
+	}
+	codelist, err := store.SelectVersion(versions, version)
+	if err != nil {
+		mgr.addError(fmt.Sprintf("ERROR: version %d of Code List \"%s\" not found", version, name))
+		return err
+	}
+	if codelist.ListStatus == 1 {
+		fmt.Printf("%s is already the active version.\n", codelist.ID)
+		return nil
+	}
+	err = mgr.client.Update(codelist.ID, b2bapi.UpdateRequest{ListStatus: 1})
+	if err != nil {
+		mgr.addError("ERROR: unable to activate \"" + codelist.ID + "\" " + err.Error())
+		return err
+	}
+	mgr.recordApplied()
+	fmt.Printf("%s activated.\n", codelist.ID)
+	return nil
+}
+
+// compareVersions prints the codes added, removed or changed going from one
+// version of a code list to another.
+func (mgr *apiMgr) compareVersions(name string, from, to int) error {
+	mgr.codelist = name
+	versions, err := mgr.listVersions()
+	if err != nil {
+		mgr.addError("ERROR: " + err.Error())
+		return err
+	}
+	items := make([][]codelistItem, 0, 2)
+	for _, version := range []int{from, to} {
+		codelist, err := store.SelectVersion(versions, version)
+		if err != nil {
+			mgr.addError(fmt.Sprintf("ERROR: version %d of Code List \"%s\" not found", version, name))
+			return err
+		}
+		items = append(items, liveItems([]b2bapi.CodeList{*codelist}))
+	}
+	fmt.Printf("Code List \"%s\": version %d -> version %d\n", name, from, to)
+	diffCodes(name, items[0], items[1]).printChanges()
+	return nil
+}
+
+// exportListVersion writes a version of a code list into a workbook or a
+// resource manager XML file.
+func (mgr *apiMgr) exportListVersion(name string, version int, output, format string) error {
+	mgr.codelist = name
+	if format != "xml" && !isSheetName(name) {
+		mgr.addError("ERROR: Code List \"" + name + "\" can not be used as a sheet name, export it as xml")
+		return fmt.Errorf("Export failed")
+	}
+	versions, err := mgr.listVersions()
+	if err != nil {
+		mgr.addError("ERROR: " + err.Error())
+		return err
+	}
+	codelist, err := store.SelectVersion(versions, version)
+	if err != nil {
+		mgr.addError(fmt.Sprintf("ERROR: version %d of Code List \"%s\" not found", version, name))
+		return err
+	}
+	if format == "xml" {
+		err = writeResourceXML(output, []b2bapi.CodeList{*codelist})
+	} else {
+		err = mgr.writeExportWorkbook(output, []b2bapi.CodeList{*codelist})
+	}
+	if err != nil {
+		mgr.addError("ERROR: unable to write " + output)
+		return err
+	}
+	fmt.Printf("%s exported to \"%s\".\n", codelist.ID, output)
+	return nil
+}
+
+// purgeVersions deletes all but the keep highest versions of the code lists
+// matching the patterns, the active version is always kept. The deleted
+// versions are saved in a backup file first.
+func (mgr *apiMgr) purgeVersions(patterns []string, keep int, dryRun bool) error {
+	codelists, err := mgr.listCodelists()
+	if err != nil {
+		mgr.addError("ERROR: unable to read the Code Lists " + err.Error())
+		return err
+	}
+	names, unmatched := matchNames(store.Names(codelists), patterns)
+	for _, pattern := range unmatched {
+		mgr.addError("ERROR: no Code List found for \"" + pattern + "\"")
+	}
+	purge := make(map[string][]b2bapi.CodeList)
+	for _, name := range names {
+		mgr.codelist = name
+		versions, err := mgr.listVersions()
+		if err != nil {
+			mgr.addError("ERROR: " + err.Error())
+			continue
+		}
+		for i, codelist := range versions {
+			if i >= len(versions)-keep || codelist.ListStatus == 1 {
+				continue
+			}
+			purge[name] = append(purge[name], codelist)
+			if dryRun {
+				fmt.Printf("%s would be deleted (%d code(s)).\n", codelist.ID, len(codelist.Codes))
+			} else {
+				mgr.WriteCodeListItem(codelist)
+			}
+		}
+	}
+	deleted := 0
+	if !dryRun && len(purge) > 0 {
+		mgr.bkpfileptr.DeleteSheet("Sheet1")
+		err = mgr.bkpfileptr.SaveAs(mgr.bkpdir + "/" + mgr.bkpfile)
+		if err != nil {
+			mgr.addError("ERROR: unable to write the backup file " + mgr.bkpfile + ", no version deleted")
+			return err
+		}
+		fmt.Println("A backup file \"" + mgr.bkpfile + "\" has been created.")
+		for _, name := range names {
+			if len(purge[name]) == 0 {
+				continue
+			}
+			mgr.codelist = name
+			for _, codelist := range purge[name] {
+				err := mgr.deleteCodelist(codelist.ID)
+				if err != nil {
+					mgr.addError("ERROR: unable to delete \"" + codelist.ID + "\" " + err.Error())
+					continue
+				}
+				fmt.Printf("%s deleted.\n", codelist.ID)
+				deleted++
+			}
+			mgr.recordApplied()
+		}
+	}
+	if dryRun {
+		count := 0
+		for _, versions := range purge {
+			count += len(versions)
+		}
+		fmt.Printf("%d Code List(s) checked, %d version(s) would be deleted.\n", len(names), count)
+	} else {
+		fmt.Printf("%d Code List(s) checked, %d version(s) deleted.\n", len(names), deleted)
+	}
+	if len(mgr.errorsList) > 0 {
+		return fmt.Errorf("Purge failed")
+	}
+	return nil
+}
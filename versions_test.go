@@ -0,0 +1,183 @@
+package main
+
+import (
+	"codelistmgr/b2bapi"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// versionNumbers returns the version numbers of the versions, the active one
+// marked with a star.
+func versionNumbers(versions []b2bapi.CodeList) string {
+	numbers := make([]string, 0, len(versions))
+	for _, codelist := range versions {
+		number := strconv.Itoa(codelist.VersionNumber)
+		if codelist.ListStatus == 1 {
+			number += "*"
+		}
+		numbers = append(numbers, number)
+	}
+	return strings.Join(numbers, ",")
+}
+
+func TestPurgeVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		keep     int
+		dryRun   bool
+		want     string
+		deleted  string
+		patterns []string
+	}{
+		{"keep 2", 2, false, "2*,4,5", "LIST|||1 LIST|||3", nil},
+		{"keep 0", 0, false, "2*", "LIST|||1 LIST|||3 LIST|||4 LIST|||5", nil},
+		{"keep the active version", 1, false, "2*,5", "LIST|||1 LIST|||3 LIST|||4", nil},
+		{"keep more than found", 10, false, "1,2*,3,4,5", "", nil},
+		{"dry run", 2, true, "1,2*,3,4,5", "", nil},
+		{"other pattern", 0, false, "1,2*,3,4,5", "", []string{"OTHER"}},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		fake, client := newFakeB2Bi(t)
+		for version := 1; version <= 5; version++ {
+			status := 0
+			if version == 2 {
+				status = 1
+			}
+			fake.put("LIST", version, status, "V"+strconv.Itoa(version))
+		}
+		fake.put("OTHER", 1, 1, "O")
+		mgr := newJournalMgr(client, dir, "")
+		backup := filepath.Join(mgr.bkpdir, mgr.bkpfile)
+		fake.before = func(r *http.Request) {
+			if r.Method == "DELETE" && !fileExists(backup) {
+				t.Errorf("%s: %s deleted before the backup file was saved", test.name, r.URL.Path)
+			}
+		}
+		var err error
+		output := captureOutput(t, func() { err = mgr.purgeVersions(test.patterns, test.keep, test.dryRun) })
+		if err != nil {
+			t.Errorf("%s: purgeVersions: %v %v", test.name, err, mgr.errorsList)
+			continue
+		}
+		if got := versionNumbers(fake.versions("LIST")); got != test.want {
+			t.Errorf("%s: LIST versions %s, want %s", test.name, got, test.want)
+		}
+		if got := versionNumbers(fake.versions("OTHER")); got != "1*" {
+			t.Errorf("%s: OTHER versions %s, want 1*", test.name, got)
+		}
+		if test.dryRun {
+			if fake.requests["DELETE"] != 0 || fileExists(backup) || !strings.Contains(output, "LIST|||3 would be deleted (1 code(s)).") {
+				t.Errorf("%s: sent %d DELETE requests, backup file %v:\n%s", test.name, fake.requests["DELETE"], fileExists(backup), output)
+			}
+			continue
+		}
+		if test.deleted == "" {
+			if fileExists(backup) {
+				t.Errorf("%s: backup file written with nothing to delete", test.name)
+			}
+			continue
+		}
+		f, err := excelize.OpenFile(backup)
+		if err != nil {
+			t.Errorf("%s: backup file: %v", test.name, err)
+			continue
+		}
+		sheets, _ := readBackupSheets(f)
+		saved := make([]string, 0, len(sheets))
+		for _, sheet := range sheets {
+			saved = append(saved, sheet.id)
+		}
+		if got := strings.Join(saved, " "); got != test.deleted {
+			t.Errorf("%s: backup of %s, want %s", test.name, got, test.deleted)
+		}
+	}
+}
+
+func TestActivateVersion(t *testing.T) {
+	fake, client := newFakeB2Bi(t)
+	fake.put("LIST", 1, 1, "A")
+	fake.put("LIST", 2, 0, "B")
+	fake.put("LIST", 3, 0, "C")
+	tests := []struct {
+		name    string
+		version int
+		valid   bool
+		want    string
+		puts    int
+	}{
+		{"inactive version", 3, true, "1,2,3*", 1},
+		{"active version", 3, true, "1,2,3*", 0},
+		{"earlier version", 1, true, "1*,2,3", 1},
+		{"missing version", 4, false, "1*,2,3", 0},
+	}
+	for _, test := range tests {
+		mgr := newJournalMgr(client, t.TempDir(), "")
+		puts := fake.requests["PUT"]
+		var err error
+		captureOutput(t, func() { err = mgr.activateVersion("LIST", test.version) })
+		if (err == nil) != test.valid {
+			t.Errorf("%s: activateVersion returned %v", test.name, err)
+		}
+		if got := versionNumbers(fake.versions("LIST")); got != test.want {
+			t.Errorf("%s: LIST versions %s, want %s", test.name, got, test.want)
+		}
+		if fake.requests["PUT"]-puts != test.puts {
+			t.Errorf("%s: sent %d PUT requests, want %d", test.name, fake.requests["PUT"]-puts, test.puts)
+		}
+		if test.puts > 0 && !fileExists(mgr.stateFile("LIST")) {
+			t.Errorf("%s: applied state not recorded", test.name)
+		}
+	}
+}
+
+func TestShowAndCompareVersions(t *testing.T) {
+	fake, client := newFakeB2Bi(t)
+	fake.put("LIST", 1, 0, "A", "B")
+	fake.put("LIST", 2, 1, "B", "C")
+	changed := fake.codelists["LIST|||2"]
+	changed.Codes[0].Description = "box"
+	changed.UserName = "apiuser"
+	fake.codelists["LIST|||2"] = changed
+	mgr := newJournalMgr(client, t.TempDir(), "")
+
+	var err error
+	output := captureOutput(t, func() { err = mgr.runVersions("LIST") })
+	if err != nil {
+		t.Fatalf("runVersions: %v", err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("%8d %8s %-20s %-20s %8d\n", 1, "inactive", "", "", 2),
+		fmt.Sprintf("%8d %8s %-20s %-20s %8d\n", 2, "active", "", "apiuser", 2),
+		"2 version(s) found.\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("versions output has no %q:\n%s", want, output)
+		}
+	}
+
+	output = captureOutput(t, func() { err = mgr.compareVersions("LIST", 1, 2) })
+	if err != nil {
+		t.Fatalf("compareVersions: %v", err)
+	}
+	want := "Code List \"LIST\": version 1 -> version 2\n" +
+		"  + C -> RC\n" +
+		"  - A -> RA\n" +
+		"  ~ B: description: \"\" -> \"box\"\n" +
+		"  1 to add, 1 to remove, 1 to change, 0 unchanged\n"
+	if output != want {
+		t.Errorf("compare output:\n%s\nwant\n%s", output, want)
+	}
+
+	if err := mgr.compareVersions("LIST", 1, 3); err == nil || !strings.Contains(strings.Join(mgr.errorsList, "\n"), "version 3 of Code List \"LIST\" not found") {
+		t.Errorf("compare with a missing version returned %v %v", err, mgr.errorsList)
+	}
+	if err := mgr.runVersions("NONE"); err == nil {
+		t.Errorf("runVersions of a missing Code List returned no error")
+	}
+}